@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/bradtumy/agent-identity-poc/internal/audit"
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"github.com/gorilla/mux"
+)
+
+// AliasRequest registers a pairwise did:peer:2 identifier for an agent. The
+// presentation authenticates the agent as for renewal; Signature proves
+// control of the alias over the same challenge.
+type AliasRequest struct {
+	Presentation json.RawMessage `json:"presentation"`
+	Alias        string          `json:"alias"`
+	// Signature is an Ed25519 signature over the presentation challenge by
+	// one of the alias's authentication keys, unpadded base64url.
+	Signature string `json:"signature"`
+}
+
+// AliasResponse confirms a registered alias.
+type AliasResponse struct {
+	DID   string `json:"did"`
+	Alias string `json:"alias"`
+}
+
+// AliasHandler handles POST /agents/{did}/aliases. The alias is stored with
+// the agent record only; nothing the broker publishes links the two.
+func AliasHandler(store *storage.FileStore, verifier *vc.Verifier, nonces *nonce.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agentDID := mux.Vars(r)["did"]
+		var req AliasRequest
+		if err := decodeBody(r, &req); err != nil || req.Signature == "" {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(req.Alias, did.PeerPrefix+"2") {
+			problem.Error(w, "alias must be a did:peer:2 identifier", http.StatusBadRequest)
+			return
+		}
+		aliasDoc, err := did.ResolvePeer(req.Alias)
+		if err != nil {
+			problem.Error(w, "invalid alias: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		current, challenge, err := verifier.VerifyPresentation(req.Presentation)
+		if challenge != "" {
+			if cerr := nonces.Consume(challenge); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		if err == nil {
+			err = verifyAliasControl(aliasDoc, challenge, req.Signature)
+		}
+		if err != nil {
+			log.Printf("alias registration failed for %s: %v", agentDID, err)
+			audit.LogAction("register_alias", agentDID, false)
+			writeVerificationError(w, err)
+			return
+		}
+		if current.CredentialSubject.ID != agentDID {
+			problem.Error(w, "presentation is not for this agent", http.StatusForbidden)
+			return
+		}
+
+		switch err := store.AddAlias(agentDID, req.Alias); {
+		case errors.Is(err, storage.ErrAgentNotFound):
+			problem.Error(w, "agent not found", http.StatusNotFound)
+			return
+		case errors.Is(err, storage.ErrAliasTaken):
+			problem.Error(w, "alias already registered", http.StatusConflict)
+			return
+		case err != nil:
+			log.Printf("storage error: %v", err)
+			problem.Error(w, "failed to store alias", http.StatusInternalServerError)
+			return
+		}
+		audit.LogAction("register_alias", agentDID, true)
+		writeBody(w, r, AliasResponse{DID: agentDID, Alias: req.Alias})
+	}
+}
+
+// verifyAliasControl checks that signature verifies with one of the alias's
+// Ed25519 authentication keys.
+func verifyAliasControl(doc *did.Document, challenge, signature string) error {
+	for _, ref := range doc.Authentication {
+		vm, ok := doc.Method(ref)
+		if !ok {
+			continue
+		}
+		pub, err := vm.PublicKey()
+		if err != nil {
+			continue
+		}
+		if edPub, ok := pub.(ed25519.PublicKey); ok {
+			if vc.JWKFromEd25519(edPub).VerifyPossession(challenge, signature) == nil {
+				return nil
+			}
+		}
+	}
+	return vc.NewError(vc.CodeSignatureInvalid, "signature does not verify with an authentication key of the alias")
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"github.com/gorilla/mux"
+)
+
+func TestAliasHandler(t *testing.T) {
+	signer, pub := testSigner(t)
+	store := storage.NewFileStore(filepath.Join(t.TempDir(), "agents.json"))
+	nonces := nonce.NewStore(time.Minute)
+	router := mux.NewRouter()
+	router.Handle("/agents/{did}/aliases", AliasHandler(store, testVerifier(pub, nil, vc.ValidityChecker{}, 3), nonces))
+
+	newAgent := func(id string) (testAgent, *vc.Credential) {
+		agent := newTestAgent(t, id)
+		cred := agent.credential(map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+		vc.Sign(cred, signer)
+		store.Save(storage.Agent{DID: id, Credential: cred})
+		return agent, cred
+	}
+	alice, aliceCred := newAgent("did:example:alice")
+	bob, bobCred := newAgent("did:example:bob")
+
+	aliasPub, aliasPriv, _ := ed25519.GenerateKey(nil)
+	alias, err := did.NewPeer2([]did.PeerKey{{Purpose: did.PeerAuthentication, Key: aliasPub}}, nil)
+	if err != nil {
+		t.Fatalf("NewPeer2: %v", err)
+	}
+
+	register := func(agent testAgent, cred *vc.Credential, aliasKey ed25519.PrivateKey) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(cred)
+		challenge, _, _ := nonces.Issue()
+		vp, _ := vc.CreatePresentation(agent.did, raw, challenge, agent.signer)
+		vpJSON, _ := json.Marshal(vp)
+		sig := base64.RawURLEncoding.EncodeToString(ed25519.Sign(aliasKey, []byte(challenge)))
+		body, _ := json.Marshal(AliasRequest{Presentation: vpJSON, Alias: alias, Signature: sig})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/agents/"+agent.did+"/aliases", bytes.NewReader(body)))
+		return rec
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	if rec := register(alice, aliceCred, otherKey); rec.Code != http.StatusUnauthorized || code(rec) != string(vc.CodeSignatureInvalid) {
+		t.Fatalf("alias registered without its key: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := register(alice, aliceCred, aliasPriv); rec.Code != http.StatusOK {
+		t.Fatalf("register alias returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := register(alice, aliceCred, aliasPriv); rec.Code != http.StatusOK {
+		t.Fatalf("re-registering an alias returned %d", rec.Code)
+	}
+	if stored, _ := store.Get(alice.did); len(stored.Aliases) != 1 || stored.Aliases[0] != alias {
+		t.Fatalf("aliases = %v", stored.Aliases)
+	}
+	if rec := register(bob, bobCred, aliasPriv); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for another agent's alias, got %d", rec.Code)
+	}
+	// A presentation for one agent cannot add aliases to another.
+	raw, _ := json.Marshal(aliceCred)
+	challenge, _, _ := nonces.Issue()
+	vp, _ := vc.CreatePresentation(alice.did, raw, challenge, alice.signer)
+	vpJSON, _ := json.Marshal(vp)
+	body, _ := json.Marshal(AliasRequest{Presentation: vpJSON, Alias: alias, Signature: base64.RawURLEncoding.EncodeToString(ed25519.Sign(aliasPriv, []byte(challenge)))})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/agents/"+bob.did+"/aliases", bytes.NewReader(body)))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another agent's presentation, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/audit"
+	"github.com/bradtumy/agent-identity-poc/internal/capability"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// CapabilityRequest asks for a capability token. The presentation proves
+// possession of the credential it is derived from, as at /execute.
+type CapabilityRequest struct {
+	Presentation json.RawMessage `json:"presentation"`
+}
+
+// CapabilityResponse carries a capability token.
+type CapabilityResponse struct {
+	Capability string `json:"capability"`
+	Expires    string `json:"expires"`
+}
+
+// CapabilityHandler handles POST /capabilities. The returned token grants the
+// credential's role until the credential expires, to the credential's holder
+// key; its holder can narrow it offline with capability.Attenuate.
+func CapabilityHandler(verifier *vc.Verifier, caps *capability.Service, nonces *nonce.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CapabilityRequest
+		if err := decodeBody(r, &req); err != nil {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		cred, challenge, err := verifier.VerifyPresentation(req.Presentation)
+		if challenge != "" {
+			if cerr := nonces.Consume(challenge); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			log.Printf("capability request verification failed: %v", err)
+			writeVerificationError(w, err)
+			return
+		}
+
+		token, expires, err := caps.Mint(cred)
+		if err != nil {
+			problem.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		audit.LogAction("mint_capability", cred.CredentialSubject.ID, true)
+		w.Header().Set("Cache-Control", "no-store")
+		writeBody(w, r, CapabilityResponse{Capability: token, Expires: expires.Format(time.RFC3339)})
+	}
+}
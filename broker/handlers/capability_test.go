@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/capability"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+func TestCapabilityExecute(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	cred := agent.credential(map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+	if err := vc.Sign(cred, signer); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	nonces := nonce.NewStore(time.Minute)
+	verifier := testVerifier(pub, nil, vc.ValidityChecker{}, 3)
+	caps := capability.NewService([]byte("secret"), nil)
+
+	// executeBody wraps a presentation; reuse it for the mint request.
+	var presented ExecuteRequest
+	json.Unmarshal(agent.executeBody(t, nonces, cred, vc.Task{}), &presented)
+	body, _ := json.Marshal(CapabilityRequest{Presentation: presented.Presentation})
+	rec := httptest.NewRecorder()
+	CapabilityHandler(verifier, caps, nonces).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/capabilities", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("mint returned %d: %s", rec.Code, rec.Body.String())
+	}
+	var minted CapabilityResponse
+	json.Unmarshal(rec.Body.Bytes(), &minted)
+
+	token, err := capability.Attenuate(minted.Capability, "url prefix=https://api.internal/", "max_calls=1")
+	if err != nil {
+		t.Fatalf("attenuate: %v", err)
+	}
+	execute := ExecuteHandler(verifier, caps, nonces, nil)
+	// signedRun presents the token with a fresh challenge signed by key.
+	signedRun := func(key ed25519.PrivateKey, url string) *httptest.ResponseRecorder {
+		req := ExecuteRequest{Capability: token, Task: vc.Task{Action: "fetch_data", Params: map[string]interface{}{"url": url}}}
+		if key != nil {
+			req.Challenge, _, _ = nonces.Issue()
+			req.Signature = base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(req.Challenge)))
+		}
+		b, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		execute.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+		return rec
+	}
+	run := func(url string) *httptest.ResponseRecorder {
+		return signedRun(agent.signer.Key, url)
+	}
+
+	// The token is bound to the credential's holder key.
+	_, otherKey, _ := ed25519.GenerateKey(nil)
+	for _, key := range []ed25519.PrivateKey{nil, otherKey} {
+		if rec := signedRun(key, "https://api.internal/users"); rec.Code != http.StatusUnauthorized || code(rec) != string(vc.CodeSignatureInvalid) {
+			t.Fatalf("capability without the holder's signature returned %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := run("https://evil.example/"); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 outside the url prefix, got %d", rec.Code)
+	}
+	if rec := run("https://api.internal/users"); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := run("https://api.internal/users"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 after max_calls, got %d", rec.Code)
+	}
+}
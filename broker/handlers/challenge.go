@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+)
+
+// ChallengeResponse carries a single-use nonce for a presentation proof.
+type ChallengeResponse struct {
+	Challenge string `json:"challenge"`
+	Expires   string `json:"expires"`
+}
+
+// ChallengeHandler handles POST /challenge
+func ChallengeHandler(nonces *nonce.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n, expires, err := nonces.Issue()
+		if err != nil {
+			log.Printf("challenge generation error: %v", err)
+			problem.Error(w, "failed to issue challenge", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(ChallengeResponse{Challenge: n, Expires: expires.UTC().Format(time.RFC3339)})
+	}
+}
@@ -1,11 +1,18 @@
 package handlers
 
 import (
-	"crypto/ed25519"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/audit"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/schema"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
 )
 
 // DelegateRequest is the expected payload for delegation.
@@ -13,50 +20,231 @@ type DelegateRequest struct {
 	DelegateeDID string `json:"delegatee_did"`
 	Role         string `json:"role"`
 	TokenTTL     int    `json:"token_ttl"`
+	// HolderKey is the delegatee's Ed25519 public key, bound into the
+	// credential so it can be presented at /execute.
+	HolderKey *vc.JWK `json:"holder_key"`
+	// Format selects the credential encoding: "ldp_vc", "jwt_vc",
+	// "vc+sd-jwt" or "vc+cose" (see AgentRequest.Format).
+	Format string `json:"format,omitempty"`
+}
+
+// DelegateResponse contains the issued delegation credential.
+type DelegateResponse struct {
+	Format     string      `json:"format"`
+	Credential interface{} `json:"credential"`
 }
 
-// DelegationToken represents the signed delegation credential.
-type DelegationToken struct {
-	Issuer            string                 `json:"issuer"`
-	CredentialSubject map[string]string      `json:"credentialSubject"`
-	Metadata          map[string]interface{} `json:"metadata"`
-	IssuanceDate      string                 `json:"issuanceDate"`
-	Proof             string                 `json:"proof"`
+// ExchangeRequest carries a legacy delegation token to be reissued.
+type ExchangeRequest struct {
+	Token     json.RawMessage `json:"token"`
+	HolderKey *vc.JWK         `json:"holder_key"`
+	Format    string          `json:"format,omitempty"`
 }
 
-// DelegateHandler handles POST /delegate requests.
-func DelegateHandler(issuer string, privKey ed25519.PrivateKey) http.HandlerFunc {
+// DelegateHandler handles POST /delegate requests. The credential gets a
+// status list entry: the agent's own when the delegatee is a registered
+// agent, which only its owner may delegate to.
+func DelegateHandler(store *storage.FileStore, statuses *statuslist.FileStore, schemas *schema.Registry, issuer string, signer vc.SignerSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req DelegateRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid payload", http.StatusBadRequest)
+		if err := decodeBody(r, &req); err != nil {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
 			return
 		}
 		if req.DelegateeDID == "" || req.Role == "" || req.TokenTTL <= 0 {
-			http.Error(w, "missing fields", http.StatusBadRequest)
+			problem.Error(w, "missing fields", http.StatusBadRequest)
+			return
+		}
+		format, ok := credentialFormat(w, r, req.Format, req.HolderKey)
+		if !ok {
 			return
 		}
 
-		token := DelegationToken{
-			Issuer:            issuer,
-			CredentialSubject: map[string]string{"id": req.DelegateeDID},
-			Metadata: map[string]interface{}{
-				"role":      req.Role,
-				"token_ttl": req.TokenTTL,
-			},
-			IssuanceDate: time.Now().UTC().Format(time.RFC3339),
+		metadata := map[string]interface{}{"role": req.Role}
+		email, _ := r.Context().Value("userEmail").(string)
+		if email != "" {
+			metadata["owner"] = email
+		}
+		agent, registered := store.Get(req.DelegateeDID)
+		if registered && agent.Owner != email {
+			audit.LogAction("delegate", req.DelegateeDID, false)
+			problem.Error(w, "only the agent's owner can delegate to it", http.StatusForbidden)
+			return
+		}
+		unsigned := vc.NewDelegation(issuer, req.DelegateeDID, metadata, time.Duration(req.TokenTTL)*time.Second)
+		unsigned.Cnf = &vc.Confirmation{JWK: req.HolderKey}
+		if !applySchema(w, schemas, unsigned) {
+			return
+		}
+		if !addStatusEntries(w, store, statuses, unsigned, agent, registered) {
+			return
 		}
+		writeDelegation(w, r, unsigned, format, signer.Current())
+	}
+}
 
-		payload, err := json.Marshal(token)
+// ExchangeHandler handles POST /delegate/exchange. It reissues a legacy
+// DelegationToken, which was a bearer token, as a credential bound to the
+// supplied holder key and issued by issuer. Subject, role and expiry are
+// preserved. Only the owner of the token's agent may exchange it, each token
+// is exchanged once, and the new credential gets a status list entry: the
+// agent's own when the subject is a registered agent, so that revoking the
+// agent revokes it.
+func ExchangeHandler(store *storage.FileStore, exchanges *storage.ExchangeLog, statuses *statuslist.FileStore, verifier *vc.Verifier, schemas *schema.Registry, issuer string, signer vc.SignerSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email, ok := r.Context().Value("userEmail").(string)
+		if !ok || email == "" {
+			problem.Error(w, "missing user email", http.StatusUnauthorized)
+			return
+		}
+		var req ExchangeRequest
+		if err := decodeBody(r, &req); err != nil || len(req.Token) == 0 {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		format, ok := credentialFormat(w, r, req.Format, req.HolderKey)
+		if !ok {
+			return
+		}
+
+		legacy, err := verifier.VerifyCredential(req.Token)
+		if err == nil && !vc.IsLegacy(legacy) {
+			problem.Error(w, "not a legacy delegation token", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
-			http.Error(w, "encoding error", http.StatusInternalServerError)
+			log.Printf("legacy token verification failed: %v", err)
+			writeVerificationError(w, err)
 			return
 		}
 
-		sig := ed25519.Sign(privKey, payload)
-		token.Proof = base64.StdEncoding.EncodeToString(sig)
+		if _, done := exchanges.Get(legacy.ID); done {
+			problem.Error(w, "legacy token already exchanged", http.StatusConflict)
+			return
+		}
+
+		subject := legacy.CredentialSubject.ID
+		owner, _ := legacy.CredentialSubject.Metadata["owner"].(string)
+		agent, registered := store.Get(subject)
+		if registered {
+			owner = agent.Owner
+		}
+		if owner != email {
+			audit.LogAction("exchange", subject, false)
+			problem.Error(w, "only the owner of the token's agent can exchange it", http.StatusForbidden)
+			return
+		}
+
+		unsigned, err := vc.MigrateLegacy(legacy)
+		if err != nil {
+			problem.Error(w, "invalid legacy token: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		unsigned.Issuer = issuer
+		unsigned.Cnf = &vc.Confirmation{JWK: req.HolderKey}
+		if !applySchema(w, schemas, unsigned) {
+			return
+		}
+
+		statusIndex, err := agentStatusIndex(agent, statuses)
+		if err != nil {
+			log.Printf("status list allocation error: %v", err)
+			problem.Error(w, "failed to issue credential", http.StatusInternalServerError)
+			return
+		}
+		setStatusEntries(unsigned, statuses, statusIndex)
+
+		err = exchanges.Record(legacy.ID, storage.Exchange{CredentialID: unsigned.ID, StatusIndex: statusIndex, Exchanged: time.Now().UTC()})
+		if errors.Is(err, storage.ErrAlreadyExchanged) {
+			audit.LogAction("exchange", subject, false)
+			problem.Error(w, "legacy token already exchanged", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("exchange log error: %v", err)
+		}
+		if registered {
+			err := store.Update(subject, func(a *storage.Agent) error {
+				if a.DID == "" {
+					return storage.ErrAgentNotFound
+				}
+				if a.StatusIndex == nil {
+					a.StatusIndex = &statusIndex
+				}
+				a.CredentialIDs = append(a.CredentialIDs, unsigned.ID)
+				return nil
+			})
+			if err != nil {
+				log.Printf("storage error: %v", err)
+			}
+		}
+		audit.LogAction("exchange", subject, true)
+		writeDelegation(w, r, unsigned, format, signer.Current())
+	}
+}
+
+// addStatusEntries gives unsigned a status list entry, the agent's own when
+// the subject is a registered agent. An agent registered before credentials
+// had status entries keeps the one allocated here.
+func addStatusEntries(w http.ResponseWriter, store *storage.FileStore, statuses *statuslist.FileStore, unsigned *vc.Credential, agent storage.Agent, registered bool) bool {
+	statusIndex, err := agentStatusIndex(agent, statuses)
+	if err != nil {
+		log.Printf("status list allocation error: %v", err)
+		problem.Error(w, "failed to issue credential", http.StatusInternalServerError)
+		return false
+	}
+	setStatusEntries(unsigned, statuses, statusIndex)
+	if registered && agent.StatusIndex == nil {
+		err := store.Update(agent.DID, func(a *storage.Agent) error {
+			if a.DID == "" {
+				return storage.ErrAgentNotFound
+			}
+			if a.StatusIndex == nil {
+				a.StatusIndex = &statusIndex
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("storage error: %v", err)
+		}
+	}
+	return true
+}
+
+// setStatusEntries points unsigned at statusIndex in the revocation and
+// suspension lists.
+func setStatusEntries(unsigned *vc.Credential, statuses *statuslist.FileStore, statusIndex int) {
+	unsigned.CredentialStatus = []vc.StatusEntry{
+		vc.NewStatusEntry(statuses.ListURL(statuslist.PurposeRevocation), statuslist.PurposeRevocation, statusIndex),
+		vc.NewStatusEntry(statuses.ListURL(statuslist.PurposeSuspension), statuslist.PurposeSuspension, statusIndex),
+	}
+}
+
+// credentialFormat validates the requested format and holder key, writing a
+// 400 response when either is unusable.
+func credentialFormat(w http.ResponseWriter, r *http.Request, format string, holderKey *vc.JWK) (string, bool) {
+	format, ok := issuanceFormat(r, format)
+	if !ok {
+		problem.Error(w, "unsupported credential format", http.StatusBadRequest)
+		return "", false
+	}
+	if holderKey == nil {
+		problem.Error(w, "missing holder_key", http.StatusBadRequest)
+		return "", false
+	}
+	if _, err := holderKey.PublicKey(); err != nil {
+		problem.Error(w, "invalid holder_key", http.StatusBadRequest)
+		return "", false
+	}
+	return format, true
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(token)
+func writeDelegation(w http.ResponseWriter, r *http.Request, unsigned *vc.Credential, format string, signer vc.Signer) {
+	cred, err := vc.Encode(unsigned, format, signer)
+	if err != nil {
+		log.Printf("credential issuance error: %v", err)
+		problem.Error(w, "encoding error", http.StatusInternalServerError)
+		return
 	}
+	writeBody(w, r, DelegateResponse{Format: format, Credential: cred})
 }
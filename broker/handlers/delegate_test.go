@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/cbor"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+func TestDelegatedCredentialExecutes(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	nonces := nonce.NewStore(time.Minute)
+	execute := ExecuteHandler(testVerifier(pub, nil, vc.ValidityChecker{}, 3), nil, nonces, nil)
+
+	store, statuses := testStores(t)
+	for _, format := range []string{"", vc.FormatJWT, vc.FormatSDJWT, vc.FormatCOSE} {
+		body, _ := json.Marshal(DelegateRequest{DelegateeDID: agent.did, Role: "data-fetcher", TokenTTL: 60, HolderKey: agent.jwk, Format: format})
+		rec := httptest.NewRecorder()
+		DelegateHandler(store, statuses, testSchemas(), testIssuer, signer).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/delegate", bytes.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: delegate returned %d: %s", format, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Credential json.RawMessage `json:"credential"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+
+		rec = httptest.NewRecorder()
+		execute.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(agent.executeBody(t, nonces, resp.Credential, vc.Task{Action: "fetch_data"}))))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: execute returned %d: %s", format, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// testStores returns empty agent and status list stores.
+func testStores(t *testing.T) (*storage.FileStore, *statuslist.FileStore) {
+	t.Helper()
+	dir := t.TempDir()
+	statuses, err := statuslist.NewFileStore(filepath.Join(dir, "status.json"), "http://localhost:8081")
+	if err != nil {
+		t.Fatalf("status store: %v", err)
+	}
+	return storage.NewFileStore(filepath.Join(dir, "agents.json")), statuses
+}
+
+func TestDelegationStatusAndOwner(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	store, statuses := testStores(t)
+	idx, _ := statuses.Allocate()
+	store.Save(storage.Agent{DID: agent.did, Owner: "alice@example.com", HolderKey: agent.jwk, StatusIndex: &idx})
+	nonces := nonce.NewStore(time.Minute)
+	handler := DelegateHandler(store, statuses, testSchemas(), testIssuer, signer)
+	execute := ExecuteHandler(testVerifier(pub, statuses, vc.ValidityChecker{}, 3), nil, nonces, nil)
+
+	delegate := func(subject testAgent, email string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(DelegateRequest{DelegateeDID: subject.did, Role: "data-fetcher", TokenTTL: 60, HolderKey: subject.jwk})
+		r := httptest.NewRequest(http.MethodPost, "/delegate", bytes.NewReader(body))
+		if email != "" {
+			r = r.WithContext(context.WithValue(r.Context(), "userEmail", email))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	issued := func(rec *httptest.ResponseRecorder) *vc.Credential {
+		t.Helper()
+		if rec.Code != http.StatusOK {
+			t.Fatalf("delegate returned %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Credential json.RawMessage `json:"credential"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		cred, err := vc.ParseCredential(resp.Credential, vc.StaticKey(pub))
+		if err != nil {
+			t.Fatalf("parse credential: %v", err)
+		}
+		return cred
+	}
+	executeCode := func(subject testAgent, cred *vc.Credential) string {
+		rec := httptest.NewRecorder()
+		execute.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(subject.executeBody(t, nonces, cred, vc.Task{Action: "fetch_data"}))))
+		if rec.Code == http.StatusOK {
+			return ""
+		}
+		return code(rec)
+	}
+
+	for _, email := range []string{"mallory@example.com", ""} {
+		if rec := delegate(agent, email); rec.Code != http.StatusForbidden {
+			t.Fatalf("delegation to another owner's agent by %q returned %d", email, rec.Code)
+		}
+	}
+
+	// A registered agent's delegations share its status entry.
+	cred := issued(delegate(agent, "alice@example.com"))
+	if len(cred.CredentialStatus) != 2 || cred.CredentialStatus[0].StatusListIndex != strconv.Itoa(idx) {
+		t.Fatalf("unexpected status entries %+v", cred.CredentialStatus)
+	}
+	if c := executeCode(agent, cred); c != "" {
+		t.Fatalf("execute returned %s", c)
+	}
+	statuses.Set(statuslist.PurposeRevocation, idx, true)
+	if c := executeCode(agent, cred); c != string(vc.CodeRevoked) {
+		t.Fatalf("revoked delegation returned %q", c)
+	}
+
+	// Other subjects get an entry of their own.
+	other := newTestAgent(t, "did:example:456")
+	cred = issued(delegate(other, ""))
+	if len(cred.CredentialStatus) != 2 || cred.CredentialStatus[0].StatusListIndex == strconv.Itoa(idx) {
+		t.Fatalf("unexpected status entries %+v", cred.CredentialStatus)
+	}
+	otherIdx, _ := strconv.Atoi(cred.CredentialStatus[0].StatusListIndex)
+	statuses.Set(statuslist.PurposeSuspension, otherIdx, true)
+	if c := executeCode(other, cred); c != string(vc.CodeSuspended) {
+		t.Fatalf("suspended delegation returned %q", c)
+	}
+}
+
+func TestCBORDelegationExecutes(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	nonces := nonce.NewStore(time.Minute)
+
+	reqBody, _ := cbor.Marshal(DelegateRequest{DelegateeDID: agent.did, Role: "data-fetcher", TokenTTL: 60, HolderKey: agent.jwk})
+	req := httptest.NewRequest(http.MethodPost, "/delegate", bytes.NewReader(reqBody))
+	req.Header.Set("Content-Type", "application/cbor")
+	req.Header.Set("Accept", "application/cbor, application/json;q=0.5")
+	rec := httptest.NewRecorder()
+	store, statuses := testStores(t)
+	DelegateHandler(store, statuses, testSchemas(), testIssuer, signer).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/cbor" {
+		t.Fatalf("delegate returned %d %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	item, err := cbor.Unmarshal(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	resp, _ := item.(map[string]interface{})
+	cose, ok := resp["credential"].([]byte)
+	if resp["format"] != vc.FormatCOSE || !ok {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+
+	// The holder signs the JSON form of the presentation, in which the
+	// credential bytes appear as base64url text.
+	challenge, _, _ := nonces.Issue()
+	credJSON, _ := json.Marshal(base64.RawURLEncoding.EncodeToString(cose))
+	vp, err := vc.CreatePresentation(agent.did, credJSON, challenge, agent.signer)
+	if err != nil {
+		t.Fatalf("create presentation: %v", err)
+	}
+	vpJSON, _ := json.Marshal(vp)
+	vpCBOR, _ := cbor.FromJSON(vpJSON)
+	vpItem, _ := cbor.Unmarshal(vpCBOR)
+	vpItem.(map[string]interface{})["verifiableCredential"] = []interface{}{cose}
+	execBody, _ := cbor.Marshal(map[string]interface{}{
+		"presentation": vpItem,
+		"task":         map[string]interface{}{"action": "fetch_data"},
+	})
+	req = httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(execBody))
+	req.Header.Set("Content-Type", "application/cbor")
+	rec = httptest.NewRecorder()
+	ExecuteHandler(testVerifier(pub, nil, vc.ValidityChecker{}, 3), nil, nonces, nil).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("execute returned %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestExchangeLegacyToken(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	nonces := nonce.NewStore(time.Minute)
+	dir := t.TempDir()
+	statuses, err := statuslist.NewFileStore(filepath.Join(dir, "status.json"), "http://localhost:8081")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := testVerifier(pub, statuses, vc.ValidityChecker{}, 3)
+	store := storage.NewFileStore(filepath.Join(dir, "agents.json"))
+	store.Save(storage.Agent{DID: agent.did, Owner: "alice@example.com"})
+	exchanges := storage.NewExchangeLog(filepath.Join(dir, "exchanges.json"))
+	handler := ExchangeHandler(store, exchanges, statuses, verifier, testSchemas(), testIssuer, signer)
+
+	legacyToken := func(subject, owner string) vc.LegacyDelegationToken {
+		token := vc.LegacyDelegationToken{
+			Issuer:            testIssuer,
+			CredentialSubject: map[string]string{"id": subject},
+			Metadata:          map[string]interface{}{"role": "data-fetcher", "owner": owner, "token_ttl": 60},
+			IssuanceDate:      time.Now().UTC().Format(time.RFC3339),
+		}
+		payload, _ := json.Marshal(token)
+		token.Proof = base64.StdEncoding.EncodeToString(ed25519.Sign(signer.Key, payload))
+		return token
+	}
+	exchange := func(token interface{}, email string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ExchangeRequest{Token: mustJSON(token), HolderKey: agent.jwk})
+		r := httptest.NewRequest(http.MethodPost, "/delegate/exchange", bytes.NewReader(body))
+		if email != "" {
+			r = r.WithContext(context.WithValue(r.Context(), "userEmail", email))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	execute := func(credential interface{}) int {
+		rec := httptest.NewRecorder()
+		ExecuteHandler(verifier, nil, nonces, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(agent.executeBody(t, nonces, credential, vc.Task{Action: "fetch_data"}))))
+		return rec.Code
+	}
+
+	// The legacy token has no holder binding, so it cannot be presented.
+	token := legacyToken(agent.did, "mallory@example.com")
+	if code := execute(token); code != http.StatusUnauthorized {
+		t.Fatalf("legacy bearer token accepted at /execute: %d", code)
+	}
+
+	// The registered agent's owner decides, not the token's metadata.
+	if rec := exchange(token, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated exchange: %d", rec.Code)
+	}
+	if rec := exchange(token, "mallory@example.com"); rec.Code != http.StatusForbidden {
+		t.Fatalf("exchange by a non-owner: %d", rec.Code)
+	}
+	rec := exchange(token, "alice@example.com")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("exchange returned %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Credential vc.Credential `json:"credential"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	exchanged := resp.Credential
+	if code := execute(exchanged); code != http.StatusOK {
+		t.Fatalf("exchanged credential rejected: %d", code)
+	}
+	if rec := exchange(token, "alice@example.com"); rec.Code != http.StatusConflict {
+		t.Fatalf("second exchange of one token: %d", rec.Code)
+	}
+
+	// The credential shares the agent's new status entry, so revoking the
+	// agent revokes it.
+	stored, _ := store.Get(agent.did)
+	if stored.StatusIndex == nil || len(exchanged.CredentialStatus) != 2 || exchanged.CredentialStatus[0].StatusListIndex != strconv.Itoa(*stored.StatusIndex) {
+		t.Fatalf("status entry not shared with the agent: %+v, agent %+v", exchanged.CredentialStatus, stored)
+	}
+	if len(stored.CredentialIDs) != 1 || stored.CredentialIDs[0] != exchanged.ID {
+		t.Fatalf("exchanged credential not recorded: %v", stored.CredentialIDs)
+	}
+	statuses.Set(statuslist.PurposeRevocation, *stored.StatusIndex, true)
+	if code := execute(exchanged); code != http.StatusUnauthorized {
+		t.Fatalf("revoked exchanged credential accepted: %d", code)
+	}
+
+	// Tokens for unregistered subjects are owned by their owner metadata
+	// and get an entry of their own (index 0 went to the agent).
+	helper := legacyToken("did:example:helper", "alice@example.com")
+	if rec := exchange(helper, "bob@example.com"); rec.Code != http.StatusForbidden {
+		t.Fatalf("exchange by a non-owner: %d", rec.Code)
+	}
+	rec = exchange(helper, "alice@example.com")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"statusListIndex":"1"`) {
+		t.Fatalf("unregistered subject: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Exchanging a current credential is refused.
+	cred := agent.credential(map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+	vc.Sign(cred, signer)
+	if rec := exchange(cred, "alice@example.com"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for non-legacy credential, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bradtumy/agent-identity-poc/internal/audit"
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/gorilla/mux"
+)
+
+// Verification relationships a key may be added under.
+var relationships = []string{"authentication", "assertionMethod", "capabilityInvocation", "capabilityDelegation", "keyAgreement"}
+
+// errInvalidUpdate marks document updates rejected with 400.
+var errInvalidUpdate = errors.New("invalid document update")
+
+// KeyRequest adds a verification method to an agent's DID document.
+type KeyRequest struct {
+	PublicKeyMultibase string `json:"public_key_multibase"`
+	// Relationships defaults to authentication and assertionMethod.
+	Relationships []string `json:"relationships,omitempty"`
+	// Replaces names a verification method removed in the same version,
+	// rotating it out.
+	Replaces string `json:"replaces,omitempty"`
+}
+
+// ServicesRequest replaces the service endpoints of an agent's DID
+// document.
+type ServicesRequest struct {
+	Services []did.Service `json:"services"`
+}
+
+// DocumentResponse returns the DID document version created by a change.
+type DocumentResponse struct {
+	VersionID   int          `json:"version_id"`
+	Document    did.Document `json:"document"`
+	Deactivated bool         `json:"deactivated,omitempty"`
+}
+
+// AgentKeyHandler handles POST /agents/{did}/keys. The new method is named
+// key-<version>, so IDs are never reused across versions.
+func AgentKeyHandler(store *storage.FileStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agent, ok := ownedAgent(w, r, store)
+		if !ok {
+			return
+		}
+		var req KeyRequest
+		if err := decodeBody(r, &req); err != nil || req.PublicKeyMultibase == "" {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		if _, err := did.DecodeMultikey(req.PublicKeyMultibase); err != nil {
+			problem.Error(w, "invalid public_key_multibase: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		rels := req.Relationships
+		if len(rels) == 0 {
+			rels = []string{"authentication", "assertionMethod"}
+		}
+		for _, rel := range rels {
+			if !slices.Contains(relationships, rel) {
+				problem.Error(w, "unknown verification relationship "+rel, http.StatusBadRequest)
+				return
+			}
+		}
+
+		version, err := store.UpdateDocument(agent.DID, func(doc *did.Document, version int) error {
+			vmID := doc.ID + "#key-" + strconv.Itoa(version)
+			if req.Replaces != "" {
+				if !removeMethod(doc, absoluteRef(doc.ID, req.Replaces)) {
+					return fmt.Errorf("%w: no verification method %s", errInvalidUpdate, req.Replaces)
+				}
+			}
+			doc.VerificationMethod = append(doc.VerificationMethod, did.VerificationMethod{
+				ID:                 vmID,
+				Type:               "Multikey",
+				Controller:         doc.ID,
+				PublicKeyMultibase: req.PublicKeyMultibase,
+			})
+			for _, rel := range rels {
+				*relationship(doc, rel) = append(*relationship(doc, rel), vmID)
+			}
+			return nil
+		})
+		writeDocumentVersion(w, r, "did:add_key", agent.DID, version, err)
+	}
+}
+
+// AgentServicesHandler handles PUT /agents/{did}/services.
+func AgentServicesHandler(store *storage.FileStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agent, ok := ownedAgent(w, r, store)
+		if !ok {
+			return
+		}
+		var req ServicesRequest
+		if err := decodeBody(r, &req); err != nil {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		version, err := store.UpdateDocument(agent.DID, func(doc *did.Document, _ int) error {
+			services := make([]did.Service, 0, len(req.Services))
+			for _, s := range req.Services {
+				s.ID = absoluteRef(doc.ID, s.ID)
+				if err := validateService(doc.ID, s); err != nil {
+					return err
+				}
+				if slices.ContainsFunc(services, func(o did.Service) bool { return o.ID == s.ID }) {
+					return fmt.Errorf("%w: duplicate service %s", errInvalidUpdate, s.ID)
+				}
+				services = append(services, s)
+			}
+			doc.Service = services
+			return nil
+		})
+		writeDocumentVersion(w, r, "did:set_services", agent.DID, version, err)
+	}
+}
+
+// DeactivateAgentHandler handles POST /agents/{did}/deactivate. Deactivation
+// is permanent and revokes the agent's credential status entry, so its
+// credentials and the capabilities minted from them stop working.
+func DeactivateAgentHandler(store *storage.FileStore, statuses *statuslist.FileStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agent, ok := ownedAgent(w, r, store)
+		if !ok {
+			return
+		}
+		version, err := store.Deactivate(agent.DID)
+		if err == nil && agent.StatusIndex != nil {
+			if serr := statuses.Set(statuslist.PurposeRevocation, *agent.StatusIndex, true); serr != nil {
+				log.Printf("status list update error: %v", serr)
+			}
+		}
+		writeDocumentVersion(w, r, "did:deactivate", agent.DID, version, err)
+	}
+}
+
+// ownedAgent loads the agent named in the path, writing an error response
+// unless the authenticated user registered it.
+func ownedAgent(w http.ResponseWriter, r *http.Request, store *storage.FileStore) (storage.Agent, bool) {
+	email, ok := r.Context().Value("userEmail").(string)
+	if !ok || email == "" {
+		problem.Error(w, "missing user email", http.StatusUnauthorized)
+		return storage.Agent{}, false
+	}
+	agent, found := store.Get(mux.Vars(r)["did"])
+	if !found {
+		problem.Error(w, "agent not found", http.StatusNotFound)
+		return storage.Agent{}, false
+	}
+	if agent.Owner != email {
+		problem.Error(w, "not the agent owner", http.StatusForbidden)
+		return storage.Agent{}, false
+	}
+	return agent, true
+}
+
+func writeDocumentVersion(w http.ResponseWriter, r *http.Request, action, agentDID string, version storage.DocumentVersion, err error) {
+	switch {
+	case errors.Is(err, errInvalidUpdate):
+		problem.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, storage.ErrAgentNotFound):
+		problem.Error(w, "agent not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrImmutableDocument):
+		problem.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, storage.ErrDeactivated):
+		problem.Error(w, err.Error(), http.StatusGone)
+	case err != nil:
+		log.Printf("storage error: %v", err)
+		problem.Error(w, "failed to update DID document", http.StatusInternalServerError)
+	default:
+		audit.LogAction(action, agentDID, true)
+		writeBody(w, r, DocumentResponse{VersionID: version.VersionID, Document: version.Document, Deactivated: version.Deactivated})
+		return
+	}
+	audit.LogAction(action, agentDID, false)
+}
+
+// absoluteRef expands a fragment ("#key-1" or "key-1") to a DID URL under id.
+func absoluteRef(id, ref string) string {
+	if ref == "" || strings.HasPrefix(ref, id+"#") {
+		return ref
+	}
+	return id + "#" + strings.TrimPrefix(ref, "#")
+}
+
+// removeMethod drops a verification method and every reference to it.
+func removeMethod(doc *did.Document, vmID string) bool {
+	n := len(doc.VerificationMethod)
+	doc.VerificationMethod = slices.DeleteFunc(doc.VerificationMethod, func(vm did.VerificationMethod) bool { return vm.ID == vmID })
+	for _, rel := range relationships {
+		refs := relationship(doc, rel)
+		*refs = slices.DeleteFunc(*refs, func(ref string) bool { return ref == vmID })
+	}
+	return len(doc.VerificationMethod) < n
+}
+
+// relationship returns the document's list for a verification relationship.
+func relationship(doc *did.Document, name string) *[]string {
+	switch name {
+	case "authentication":
+		return &doc.Authentication
+	case "assertionMethod":
+		return &doc.AssertionMethod
+	case "capabilityInvocation":
+		return &doc.CapabilityInvocation
+	case "capabilityDelegation":
+		return &doc.CapabilityDelegation
+	default:
+		return &doc.KeyAgreement
+	}
+}
+
+// validateService requires a type and an absolute http(s) endpoint URL, or a
+// structured endpoint.
+func validateService(id string, s did.Service) error {
+	if s.ID == "" || s.Type == "" || s.ServiceEndpoint == nil {
+		return fmt.Errorf("%w: services need an id, type and serviceEndpoint", errInvalidUpdate)
+	}
+	if endpoint, ok := s.ServiceEndpoint.(string); ok {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("%w: service %s endpoint must be an http(s) URL", errInvalidUpdate, s.ID)
+		}
+	}
+	return nil
+}
+
+// resolutionContentType is the media type of DID resolution results.
+const resolutionContentType = `application/ld+json;profile="https://w3id.org/did-resolution"`
+
+// ResolutionResult is a DID resolution result.
+type ResolutionResult struct {
+	Context               string                 `json:"@context"`
+	DIDDocument           *did.Document          `json:"didDocument"`
+	DIDResolutionMetadata map[string]interface{} `json:"didResolutionMetadata"`
+	DIDDocumentMetadata   map[string]interface{} `json:"didDocumentMetadata"`
+}
+
+// DIDResolutionHandler handles GET /1.0/identifiers/{did}, resolving agent
+// DIDs in the Universal Resolver format. ?versionId=N selects an earlier
+// version of the document. A deactivated document is served with 410 Gone.
+func DIDResolutionHandler(store *storage.FileStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		write := func(status int, result ResolutionResult) {
+			result.Context = "https://w3id.org/did-resolution/v1"
+			if result.DIDDocumentMetadata == nil {
+				result.DIDDocumentMetadata = map[string]interface{}{}
+			}
+			w.Header().Set("Content-Type", resolutionContentType)
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(result)
+		}
+		fail := func(status int, code string) {
+			write(status, ResolutionResult{DIDResolutionMetadata: map[string]interface{}{"error": code}})
+		}
+
+		agent, found := store.Get(mux.Vars(r)["did"])
+		versions := agent.Versions()
+		if !found || len(versions) == 0 {
+			fail(http.StatusNotFound, "notFound")
+			return
+		}
+		v := versions[len(versions)-1]
+		if q := r.URL.Query().Get("versionId"); q != "" {
+			n, err := strconv.Atoi(q)
+			if err != nil || n < 1 {
+				fail(http.StatusBadRequest, "invalidDidUrl")
+				return
+			}
+			if n > len(versions) {
+				fail(http.StatusNotFound, "notFound")
+				return
+			}
+			v = versions[n-1]
+		}
+
+		meta := map[string]interface{}{"versionId": strconv.Itoa(v.VersionID)}
+		if created := versions[0].Updated; !created.IsZero() {
+			meta["created"] = created
+		}
+		if v.VersionID > 1 {
+			meta["updated"] = v.Updated
+		}
+		if v.VersionID < len(versions) {
+			meta["nextVersionId"] = strconv.Itoa(v.VersionID + 1)
+		}
+		status := http.StatusOK
+		if v.Deactivated {
+			meta["deactivated"] = true
+			status = http.StatusGone
+		}
+		doc := v.Document
+		write(status, ResolutionResult{
+			DIDDocument:           &doc,
+			DIDResolutionMetadata: map[string]interface{}{"contentType": "application/did+json"},
+			DIDDocumentMetadata:   meta,
+		})
+	}
+}
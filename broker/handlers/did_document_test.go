@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"github.com/gorilla/mux"
+)
+
+func TestAgentDocumentLifecycle(t *testing.T) {
+	const agentDID = "did:example:123"
+	agent := newTestAgent(t, agentDID)
+	store := storage.NewFileStore(filepath.Join(t.TempDir(), "agents.json"))
+	// Stored without document versions, as before documents were versioned.
+	store.Save(storage.Agent{DID: agentDID, Owner: "alice@example.com", HolderKey: agent.jwk})
+	statuses, err := statuslist.NewFileStore(filepath.Join(t.TempDir(), "status.json"), "http://localhost:8081")
+	if err != nil {
+		t.Fatalf("status store: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.Handle("/agents/{did}/keys", AgentKeyHandler(store)).Methods(http.MethodPost)
+	router.Handle("/agents/{did}/services", AgentServicesHandler(store)).Methods(http.MethodPut)
+	router.Handle("/agents/{did}/deactivate", DeactivateAgentHandler(store, statuses)).Methods(http.MethodPost)
+	router.Handle("/1.0/identifiers/{did}", DIDResolutionHandler(store)).Methods(http.MethodGet)
+	call := func(method, path, owner string, body interface{}) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		r := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		r = r.WithContext(context.WithValue(r.Context(), "userEmail", owner))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		return rec
+	}
+	resolve := func(query string) (int, ResolutionResult) {
+		rec := call(http.MethodGet, "/1.0/identifiers/"+agentDID+query, "", nil)
+		var res ResolutionResult
+		json.Unmarshal(rec.Body.Bytes(), &res)
+		return rec.Code, res
+	}
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	mb, _ := did.EncodeMultikey(pub)
+	rotate := KeyRequest{PublicKeyMultibase: mb, Replaces: "#key-1"}
+	if rec := call(http.MethodPost, "/agents/"+agentDID+"/keys", "mallory@example.com", rotate); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-owner changed the document: %d", rec.Code)
+	}
+	rec := call(http.MethodPost, "/agents/"+agentDID+"/keys", "alice@example.com", rotate)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate key returned %d: %s", rec.Code, rec.Body.String())
+	}
+	var v2 DocumentResponse
+	json.Unmarshal(rec.Body.Bytes(), &v2)
+	if v2.VersionID != 2 || len(v2.Document.VerificationMethod) != 1 || v2.Document.VerificationMethod[0].ID != agentDID+"#key-2" {
+		t.Fatalf("unexpected version: %+v", v2)
+	}
+	if len(v2.Document.Authentication) != 1 || v2.Document.Authentication[0] != agentDID+"#key-2" {
+		t.Fatalf("rotated key not referenced: %v", v2.Document.Authentication)
+	}
+
+	services := ServicesRequest{Services: []did.Service{{ID: "#callback", Type: "AgentCallback", ServiceEndpoint: "https://agent.example/callback"}}}
+	if rec := call(http.MethodPut, "/agents/"+agentDID+"/services", "alice@example.com", ServicesRequest{Services: []did.Service{{ID: "#bad", Type: "X", ServiceEndpoint: "ftp://x"}}}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a non-http endpoint, got %d", rec.Code)
+	}
+	if rec := call(http.MethodPut, "/agents/"+agentDID+"/services", "alice@example.com", services); rec.Code != http.StatusOK {
+		t.Fatalf("set services returned %d: %s", rec.Code, rec.Body.String())
+	}
+
+	code, res := resolve("")
+	if code != http.StatusOK || res.DIDDocumentMetadata["versionId"] != "3" || len(res.DIDDocument.Service) != 1 || res.DIDDocument.Service[0].ID != agentDID+"#callback" {
+		t.Fatalf("current version: %d %+v", code, res)
+	}
+	code, res = resolve("?versionId=1")
+	if code != http.StatusOK || res.DIDDocumentMetadata["nextVersionId"] != "2" {
+		t.Fatalf("version 1: %d %+v", code, res.DIDDocumentMetadata)
+	}
+	if _, ok := res.DIDDocument.Method(agentDID + "#key-1"); !ok {
+		t.Fatal("version 1 does not list the holder key")
+	}
+	if code, _ := resolve("?versionId=9"); code != http.StatusNotFound {
+		t.Fatalf("unknown version returned %d", code)
+	}
+	if doc, err := store.Resolve(context.Background(), agentDID); err != nil || len(doc.Service) != 1 {
+		t.Fatalf("store resolution: %v", err)
+	}
+
+	if rec := call(http.MethodPost, "/agents/"+agentDID+"/deactivate", "alice@example.com", nil); rec.Code != http.StatusOK {
+		t.Fatalf("deactivate returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if code, res := resolve(""); code != http.StatusGone || res.DIDDocumentMetadata["deactivated"] != true || len(res.DIDDocument.VerificationMethod) != 0 {
+		t.Fatalf("deactivated DID: %d %+v", code, res)
+	}
+	if rec := call(http.MethodPost, "/agents/"+agentDID+"/keys", "alice@example.com", KeyRequest{PublicKeyMultibase: mb}); rec.Code != http.StatusGone {
+		t.Fatalf("deactivated document changed: %d", rec.Code)
+	}
+	if _, err := store.Resolve(context.Background(), agentDID); err == nil {
+		t.Fatal("deactivated DID still resolves")
+	}
+}
+
+func TestDocumentChangesInvalidateCredentials(t *testing.T) {
+	const agentDID = "did:example:123"
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, agentDID)
+	store := storage.NewFileStore(filepath.Join(t.TempDir(), "agents.json"))
+	statuses, err := statuslist.NewFileStore(filepath.Join(t.TempDir(), "status.json"), "http://localhost:8081")
+	if err != nil {
+		t.Fatalf("status store: %v", err)
+	}
+	idx, _ := statuses.Allocate()
+	store.Save(storage.Agent{DID: agentDID, Owner: "alice@example.com", HolderKey: agent.jwk, StatusIndex: &idx})
+
+	router := mux.NewRouter()
+	router.Handle("/agents/{did}/keys", AgentKeyHandler(store)).Methods(http.MethodPost)
+	router.Handle("/agents/{did}/deactivate", DeactivateAgentHandler(store, statuses)).Methods(http.MethodPost)
+	call := func(path string, body interface{}) {
+		t.Helper()
+		raw, _ := json.Marshal(body)
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(raw))
+		r = r.WithContext(context.WithValue(r.Context(), "userEmail", "alice@example.com"))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s returned %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	issue := func(key *vc.JWK, status bool) json.RawMessage {
+		t.Helper()
+		cred := vc.NewDelegation(testIssuer, agentDID, map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+		cred.Cnf = &vc.Confirmation{JWK: key}
+		if status {
+			cred.CredentialStatus = []vc.StatusEntry{vc.NewStatusEntry(statuses.ListURL(statuslist.PurposeRevocation), statuslist.PurposeRevocation, idx)}
+		}
+		if err := vc.Sign(cred, signer); err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		raw, _ := json.Marshal(cred)
+		return raw
+	}
+	verifier := testVerifier(pub, statuses, vc.ValidityChecker{}, 3)
+	verifier.Subjects = store
+
+	old := issue(agent.jwk, false)
+	if _, err := verifier.VerifyCredential(old); err != nil {
+		t.Fatalf("credential rejected before rotation: %v", err)
+	}
+	newPub, _, _ := ed25519.GenerateKey(nil)
+	mb, _ := did.EncodeMultikey(newPub)
+	call("/agents/"+agentDID+"/keys", KeyRequest{PublicKeyMultibase: mb, Replaces: "#key-1"})
+	if _, err := verifier.VerifyCredential(old); !errors.Is(err, vc.ErrRevoked) {
+		t.Fatalf("credential bound to the rotated-out key: %v", err)
+	}
+	current := issue(vc.JWKFromEd25519(newPub), true)
+	if _, err := verifier.VerifyCredential(current); err != nil {
+		t.Fatalf("credential bound to the new key rejected: %v", err)
+	}
+
+	call("/agents/"+agentDID+"/deactivate", nil)
+	if _, err := verifier.VerifyCredential(current); !errors.Is(err, vc.ErrRevoked) {
+		t.Fatalf("credential of a deactivated agent: %v", err)
+	}
+	// Without the subject check the revocation bit still applies.
+	verifier.Subjects = nil
+	if _, err := verifier.VerifyCredential(current); !errors.Is(err, vc.ErrRevoked) {
+		t.Fatalf("deactivation did not revoke the status entry: %v", err)
+	}
+}
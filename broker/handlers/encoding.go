@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bradtumy/agent-identity-poc/internal/cbor"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// mediaTypeCBOR selects CBOR request and response bodies.
+const mediaTypeCBOR = "application/cbor"
+
+// maxCBORBody bounds CBOR request bodies, which are read whole.
+const maxCBORBody = 1 << 20
+
+// acceptsCBOR reports whether the Accept header lists application/cbor with
+// a non-zero quality.
+func acceptsCBOR(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mt != mediaTypeCBOR {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err != nil || v <= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// decodeBody decodes a JSON request body into v, or a CBOR body when the
+// Content-Type is application/cbor. Byte strings in CBOR bodies are read as
+// base64url text, so a COSE credential may be sent as raw bytes.
+func decodeBody(r *http.Request, v interface{}) error {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt != mediaTypeCBOR {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxCBORBody))
+	if err != nil {
+		return err
+	}
+	raw, err := cbor.ToJSON(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// writeBody writes v as JSON, or as CBOR when the client accepts it. A
+// vc+cose credential in a CBOR response is sent as a byte string.
+func writeBody(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if !acceptsCBOR(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+		return
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		problem.Error(w, "encoding error", http.StatusInternalServerError)
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		problem.Error(w, "encoding error", http.StatusInternalServerError)
+		return
+	}
+	if m, ok := generic.(map[string]interface{}); ok && m["format"] == vc.FormatCOSE {
+		if s, ok := m["credential"].(string); ok {
+			if b, err := base64.RawURLEncoding.DecodeString(s); err == nil {
+				m["credential"] = b
+			}
+		}
+	}
+	body, err := cbor.Marshal(generic)
+	if err != nil {
+		problem.Error(w, "encoding error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mediaTypeCBOR)
+	w.Write(body)
+}
+
+// issuanceFormat returns the requested credential format, defaulting to
+// vc+cose for clients that accept CBOR and ldp_vc otherwise.
+func issuanceFormat(r *http.Request, format string) (string, bool) {
+	if format == "" {
+		if acceptsCBOR(r) {
+			return vc.FormatCOSE, true
+		}
+		return vc.FormatLDP, true
+	}
+	return format, vc.SupportedFormat(format)
+}
@@ -8,15 +8,28 @@ import (
 	"time"
 
 	"github.com/bradtumy/agent-identity-poc/internal/audit"
+	"github.com/bradtumy/agent-identity-poc/internal/capability"
 	"github.com/bradtumy/agent-identity-poc/internal/executionlog"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
 	"github.com/bradtumy/agent-identity-poc/internal/policy"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
 	"github.com/bradtumy/agent-identity-poc/internal/vc"
 )
 
 // ExecuteRequest payload for POST /execute
 type ExecuteRequest struct {
-	Credential vc.Credential `json:"credential"`
-	Task       vc.Task       `json:"task"`
+	// Presentation is a vc.Presentation signed with the agent's holder key
+	// over a challenge from /challenge. Its credential may be an LDP
+	// credential object or a JWT-VC / SD-JWT string.
+	Presentation json.RawMessage `json:"presentation,omitempty"`
+	// Capability is a capability token from /capabilities, optionally
+	// attenuated with caveats, used instead of a presentation. Challenge is
+	// then a nonce from /challenge and Signature the holder key's Ed25519
+	// signature over it, unpadded base64url.
+	Capability string  `json:"capability,omitempty"`
+	Challenge  string  `json:"challenge,omitempty"`
+	Signature  string  `json:"signature,omitempty"`
+	Task       vc.Task `json:"task"`
 }
 
 // TaskRequest describes an agent action
@@ -26,15 +39,12 @@ type TaskRequest struct {
 }
 
 // ExecuteHandler handles POST /execute requests
-func ExecuteHandler(signingSecret []byte, logger *executionlog.Logger) http.HandlerFunc {
-	// trusted issuer list and shared secret used for VC validation
-	trustedIssuers := []string{"http://keycloak:8080/realms/agent-identity-poc"}
-	sharedSecret := []byte("mysecret")
+func ExecuteHandler(verifier *vc.Verifier, caps *capability.Service, nonces *nonce.Store, logger *executionlog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req ExecuteRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err := decodeBody(r, &req); err != nil {
 			log.Println("failed to decode execute request:", err)
-			http.Error(w, "invalid payload", http.StatusBadRequest)
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
 			if logger != nil {
 				entry := executionlog.Entry{
 					Timestamp: time.Now().UTC().Format(time.RFC3339),
@@ -48,96 +58,87 @@ func ExecuteHandler(signingSecret []byte, logger *executionlog.Logger) http.Hand
 			return
 		}
 
-		cred := req.Credential
-		role, _ := cred.CredentialSubject.Metadata["role"].(string)
 		action := req.Task.Action
 		entry := executionlog.Entry{
 			Timestamp: time.Now().UTC().Format(time.RFC3339),
-			AgentDID:  cred.CredentialSubject.ID,
-			Role:      role,
 			Action:    action,
 		}
-
-		if err := vc.VerifySignature(&cred, sharedSecret); err != nil {
-			subj := cred.CredentialSubject.ID
-			audit.LogAction("execute", subj, false)
-			entry.Status = "failure"
-			entry.Message = "invalid credential signature"
-			if logger != nil {
-				if err := logger.Log(entry); err != nil {
-					log.Printf("execution log error: %v", err)
+		var (
+			parsed *vc.Credential
+			grant  *capability.Grant
+			err    error
+		)
+		subj := ""
+		if req.Capability != "" {
+			if caps == nil {
+				err = fmt.Errorf("%w: capabilities are not enabled", capability.ErrInvalid)
+			} else {
+				grant, err = caps.Verify(req.Capability, req.Task)
+			}
+			if err == nil {
+				err = grant.VerifyHolder(req.Challenge, req.Signature)
+			}
+			if req.Challenge != "" {
+				if cerr := nonces.Consume(req.Challenge); cerr != nil && err == nil {
+					err = cerr
 				}
 			}
-			http.Error(w, "invalid credential signature", http.StatusUnauthorized)
-			return
-		}
-
-		if err := vc.CheckTrustedIssuer(&cred, trustedIssuers); err != nil {
-			subj := cred.CredentialSubject.ID
-			audit.LogAction("execute", subj, false)
-			entry.Status = "failure"
-			entry.Message = "untrusted issuer"
-			if logger != nil {
-				if err := logger.Log(entry); err != nil {
-					log.Printf("execution log error: %v", err)
+			if grant != nil {
+				subj = grant.Subject
+				entry.AgentDID = subj
+				entry.Role = grant.Role
+			}
+		} else {
+			var challenge string
+			parsed, challenge, err = verifier.VerifyPresentation(req.Presentation)
+			if challenge != "" {
+				if cerr := nonces.Consume(challenge); cerr != nil && err == nil {
+					err = cerr
 				}
 			}
-			http.Error(w, "untrusted issuer", http.StatusUnauthorized)
-			return
+			if parsed != nil {
+				subj = parsed.CredentialSubject.ID
+				entry.AgentDID = subj
+				entry.Role, _ = parsed.CredentialSubject.Metadata["role"].(string)
+			}
 		}
-
-		if err := vc.ValidateTTL(&cred); err != nil {
-			subj := cred.CredentialSubject.ID
-			log.Printf("token TTL validation failed for %s: %v", subj, err)
+		fail := func(err error) {
+			log.Printf("execute denied for %q: %v", subj, err)
 			audit.LogAction("execute", subj, false)
 			entry.Status = "failure"
-			entry.Message = "expired credential"
+			entry.Message = err.Error()
 			if logger != nil {
 				if err := logger.Log(entry); err != nil {
 					log.Printf("execution log error: %v", err)
 				}
 			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error":   "expired_token",
-				"message": "The delegation token has expired.",
-			})
+			writeVerificationError(w, err)
+		}
+		if err != nil {
+			fail(err)
 			return
 		}
 
-		meta := cred.CredentialSubject.Metadata
-		role, roleOK := meta["role"].(string)
-		if !roleOK {
-			subj := cred.CredentialSubject.ID
-			audit.LogAction("execute", subj, false)
-			entry.Status = "failure"
-			entry.Message = "missing role"
-			if logger != nil {
-				if err := logger.Log(entry); err != nil {
-					log.Printf("execution log error: %v", err)
-				}
-			}
-			http.Error(w, "missing role", http.StatusForbidden)
+		role := entry.Role
+		if parsed != nil {
+			role, _ = parsed.CredentialSubject.Metadata["role"].(string)
+		}
+		if err := policy.ValidatePolicy(action, role); err != nil {
+			fail(err)
 			return
 		}
 
-		if err := policy.ValidatePolicy(action, role); err != nil {
-			subj := cred.CredentialSubject.ID
-			audit.LogAction("execute", subj, false)
-			entry.Status = "failure"
-			entry.Message = "policy check failed: " + err.Error()
-			if logger != nil {
-				if err := logger.Log(entry); err != nil {
-					log.Printf("execution log error: %v", err)
-				}
+		if grant != nil {
+			if err := grant.Use(); err != nil {
+				fail(err)
+				return
 			}
-			http.Error(w, "policy check failed: "+err.Error(), http.StatusForbidden)
+		} else if err := vc.CheckTask(parsed, req.Task); err != nil {
+			fail(err)
 			return
 		}
 
 		// Log success
-		subj := cred.CredentialSubject.ID
 		audit.LogAction("execute", subj, true)
 		entry.Status = "success"
 		// Generate a simple success message
@@ -154,7 +155,6 @@ func ExecuteHandler(signingSecret []byte, logger *executionlog.Logger) http.Hand
 			}
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
+		writeBody(w, r, map[string]string{"result": "ok"})
 	}
 }
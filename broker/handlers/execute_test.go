@@ -2,41 +2,323 @@ package handlers
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/schema"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
 	"github.com/bradtumy/agent-identity-poc/internal/vc"
 )
 
-func TestExecuteHandlerExpiredToken(t *testing.T) {
-	secret := []byte("mysecret")
-	cred, err := vc.IssueDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{"role": "data-fetcher", "token_ttl": 1}, secret)
+const testIssuer = "http://keycloak:8080/realms/agent-identity-poc"
+
+func testSigner(t *testing.T) (vc.Signer, ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
 	if err != nil {
-		t.Fatalf("issue credential: %v", err)
+		t.Fatalf("generate key: %v", err)
+	}
+	return vc.Signer{VerificationMethod: testIssuer + "#broker-key-1", Key: priv}, pub
+}
+
+func testVerifier(pub ed25519.PublicKey, statuses vc.StatusLookup, validity vc.ValidityChecker, maxDepth int) *vc.Verifier {
+	return &vc.Verifier{
+		Keys:          vc.StaticKey(pub),
+		Issuers:       vc.TrustedIssuers{testIssuer},
+		Validity:      validity,
+		Statuses:      statuses,
+		Schemas:       testSchemas(),
+		MaxChainDepth: maxDepth,
+	}
+}
+
+func testSchemas() *schema.Registry {
+	schemas, err := schema.NewRegistry("http://localhost:8081")
+	if err != nil {
+		panic(err)
+	}
+	return schemas
+}
+
+// testAgent is an agent DID with its holder key pair.
+type testAgent struct {
+	did    string
+	signer vc.Signer
+	jwk    *vc.JWK
+}
+
+func newTestAgent(t *testing.T, did string) testAgent {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
 	}
+	return testAgent{did: did, signer: vc.Signer{VerificationMethod: did + "#holder", Key: priv}, jwk: vc.JWKFromEd25519(pub)}
+}
+
+// credential builds an unsigned credential bound to the agent's key.
+func (a testAgent) credential(metadata map[string]interface{}, ttl time.Duration) *vc.Credential {
+	cred := vc.NewDelegation(testIssuer, a.did, metadata, ttl)
+	cred.Cnf = &vc.Confirmation{JWK: a.jwk}
+	return cred
+}
 
-	time.Sleep(2 * time.Second)
+// executeBody presents credential (a *vc.Credential or encoded string) over
+// a fresh challenge from nonces.
+func (a testAgent) executeBody(t *testing.T, nonces *nonce.Store, credential interface{}, task vc.Task) []byte {
+	t.Helper()
+	raw, _ := json.Marshal(credential)
+	challenge, _, err := nonces.Issue()
+	if err != nil {
+		t.Fatalf("issue challenge: %v", err)
+	}
+	vp, err := vc.CreatePresentation(a.did, raw, challenge, a.signer)
+	if err != nil {
+		t.Fatalf("create presentation: %v", err)
+	}
+	vpJSON, _ := json.Marshal(vp)
+	b, _ := json.Marshal(ExecuteRequest{Presentation: vpJSON, Task: task})
+	return b
+}
 
-	reqPayload := ExecuteRequest{Credential: *cred, Task: vc.Task{Action: "fetch_data"}}
-	b, _ := json.Marshal(reqPayload)
+func TestExecuteHandlerExpiredToken(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	cred := agent.credential(map[string]interface{}{"role": "data-fetcher", "token_ttl": 1}, 0)
+	if err := vc.Sign(cred, signer); err != nil {
+		t.Fatalf("issue credential: %v", err)
+	}
+
+	nonces := nonce.NewStore(time.Minute)
+	b := agent.executeBody(t, nonces, cred, vc.Task{Action: "fetch_data"})
 	req := httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b))
 	rec := httptest.NewRecorder()
 
-	handler := ExecuteHandler(secret, nil)
+	later := vc.ValidityChecker{Now: func() time.Time { return time.Now().Add(2 * time.Second) }}
+	handler := ExecuteHandler(testVerifier(pub, nil, later, 3), nil, nonces, nil)
 	handler.ServeHTTP(rec, req)
 
 	if rec.Code != http.StatusUnauthorized {
 		t.Fatalf("expected 401 got %d", rec.Code)
 	}
 
-	var resp map[string]string
+	if ct := rec.Header().Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	var resp problem.Details
 	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
 		t.Fatalf("invalid json: %v", err)
 	}
-	if resp["error"] != "expired_token" {
+	if resp.Code != string(vc.CodeExpired) || resp.Status != http.StatusUnauthorized {
 		t.Fatalf("unexpected response: %v", resp)
 	}
 }
+
+func TestExecuteHandlerJWTCredential(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	cred := agent.credential(map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+	jwt, err := vc.EncodeJWT(cred, signer)
+	if err != nil {
+		t.Fatalf("encode jwt: %v", err)
+	}
+
+	nonces := nonce.NewStore(time.Minute)
+	b := agent.executeBody(t, nonces, jwt, vc.Task{Action: "fetch_data"})
+	req := httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b))
+	rec := httptest.NewRecorder()
+
+	ExecuteHandler(testVerifier(pub, nil, vc.ValidityChecker{}, 3), nil, nonces, nil).ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestExecuteHandlerRejectsReplayAndForeignHolder(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	cred := agent.credential(map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+	if err := vc.Sign(cred, signer); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	nonces := nonce.NewStore(time.Minute)
+	handler := ExecuteHandler(testVerifier(pub, nil, vc.ValidityChecker{}, 3), nil, nonces, nil)
+
+	b := agent.executeBody(t, nonces, cred, vc.Task{Action: "fetch_data"})
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed presentation accepted: %d", rec.Code)
+	}
+
+	// Someone who has seen the credential cannot present it with their own key.
+	thief := newTestAgent(t, "did:example:123")
+	b = thief.executeBody(t, nonces, cred, vc.Task{Action: "fetch_data"})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("presentation by a foreign key accepted: %d", rec.Code)
+	}
+
+	// A challenge the broker never issued is rejected.
+	vp, _ := vc.CreatePresentation(agent.did, mustJSON(cred), "made-up", agent.signer)
+	b, _ = json.Marshal(ExecuteRequest{Presentation: mustJSON(vp), Task: vc.Task{Action: "fetch_data"}})
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown challenge accepted: %d", rec.Code)
+	}
+}
+
+func mustJSON(v interface{}) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+func TestExecuteHandlerRevokedCredential(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	statuses, err := statuslist.NewFileStore(filepath.Join(t.TempDir(), "status.json"), "http://localhost:8081")
+	if err != nil {
+		t.Fatalf("status store: %v", err)
+	}
+	idx, _ := statuses.Allocate()
+	cred := agent.credential(map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+	cred.CredentialStatus = []vc.StatusEntry{
+		vc.NewStatusEntry(statuses.ListURL(statuslist.PurposeRevocation), statuslist.PurposeRevocation, idx),
+		vc.NewStatusEntry(statuses.ListURL(statuslist.PurposeSuspension), statuslist.PurposeSuspension, idx),
+	}
+	if err := vc.Sign(cred, signer); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	nonces := nonce.NewStore(time.Minute)
+	handler := ExecuteHandler(testVerifier(pub, statuses, vc.ValidityChecker{}, 3), nil, nonces, nil)
+
+	tests := []struct {
+		purpose string
+		want    string
+	}{
+		{statuslist.PurposeSuspension, "suspended"},
+		{statuslist.PurposeRevocation, "revoked"},
+	}
+	for _, tc := range tests {
+		if err := statuses.Set(tc.purpose, idx, true); err != nil {
+			t.Fatalf("set status: %v", err)
+		}
+		b := agent.executeBody(t, nonces, cred, vc.Task{Action: "fetch_data"})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 got %d", rec.Code)
+		}
+		var resp problem.Details
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		if resp.Code != tc.want {
+			t.Fatalf("expected %s, got %v", tc.want, resp)
+		}
+		statuses.Set(tc.purpose, idx, false)
+	}
+}
+
+func TestExecuteHandlerNotYetValid(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	cred := agent.credential(map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+	if err := vc.Sign(cred, signer); err != nil {
+		t.Fatalf("issue credential: %v", err)
+	}
+	nonces := nonce.NewStore(time.Minute)
+
+	earlier := vc.ValidityChecker{Now: func() time.Time { return time.Now().Add(-time.Minute) }}
+	b := agent.executeBody(t, nonces, cred, vc.Task{Action: "fetch_data"})
+	rec := httptest.NewRecorder()
+	ExecuteHandler(testVerifier(pub, nil, earlier, 3), nil, nonces, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+	var resp problem.Details
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusUnauthorized || resp.Code != "not_yet_valid" {
+		t.Fatalf("expected not_yet_valid, got %d %v", rec.Code, resp)
+	}
+
+	earlier.Skew = 2 * time.Minute
+	b = agent.executeBody(t, nonces, cred, vc.Task{Action: "fetch_data"})
+	rec = httptest.NewRecorder()
+	ExecuteHandler(testVerifier(pub, nil, earlier, 3), nil, nonces, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected skew tolerance to accept credential, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestExecuteHandlerDelegationChain(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:agent")
+	helper := newTestAgent(t, "did:example:helper")
+	root := agent.credential(map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+	if err := vc.Sign(root, signer); err != nil {
+		t.Fatalf("sign root: %v", err)
+	}
+	child, err := vc.IssueSubDelegation(root, helper.did, helper.jwk, map[string]interface{}{"role": "data-fetcher", "actions": []string{"fetch_data"}}, time.Minute, agent.signer)
+	if err != nil {
+		t.Fatalf("sub-delegate: %v", err)
+	}
+	nonces := nonce.NewStore(time.Minute)
+
+	b := helper.executeBody(t, nonces, child, vc.Task{Action: "fetch_data"})
+	rec := httptest.NewRecorder()
+	ExecuteHandler(testVerifier(pub, nil, vc.ValidityChecker{}, 1), nil, nonces, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	b = helper.executeBody(t, nonces, child, vc.Task{Action: "fetch_data"})
+	rec = httptest.NewRecorder()
+	ExecuteHandler(testVerifier(pub, nil, vc.ValidityChecker{}, 0), nil, nonces, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for chain deeper than allowed, got %d", rec.Code)
+	}
+}
+
+func TestExecuteHandlerSchemaViolation(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	cred := agent.credential(map[string]interface{}{"rol": "data-fetcher"}, time.Hour)
+	cred.CredentialSchema = []vc.SchemaRef{vc.NewSchemaRef("http://localhost:8081/schemas/AgentDelegation/1.0")}
+	if err := vc.Sign(cred, signer); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	nonces := nonce.NewStore(time.Minute)
+	b := agent.executeBody(t, nonces, cred, vc.Task{Action: "fetch_data"})
+	rec := httptest.NewRecorder()
+	ExecuteHandler(testVerifier(pub, nil, vc.ValidityChecker{}, 3), nil, nonces, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+
+	var resp struct {
+		Code   string              `json:"code"`
+		Errors []schema.FieldError `json:"errors"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusForbidden || resp.Code != "schema_invalid" {
+		t.Fatalf("expected schema_invalid, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := map[string]bool{"/credentialSubject/metadata/role": true, "/credentialSubject/metadata/rol": true}
+	if len(resp.Errors) != len(want) {
+		t.Fatalf("unexpected field errors: %+v", resp.Errors)
+	}
+	for _, fe := range resp.Errors {
+		if !want[fe.Field] {
+			t.Fatalf("unexpected field error: %+v", fe)
+		}
+	}
+}
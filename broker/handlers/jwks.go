@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/bradtumy/agent-identity-poc/internal/keys"
+)
+
+// JWKSHandler handles GET /.well-known/jwks.json. It publishes the current
+// signing key and the retired keys still inside their overlap window.
+func JWKSHandler(manager *keys.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/jwk-set+json")
+		w.Header().Set("Cache-Control", "max-age=300")
+		json.NewEncoder(w).Encode(manager.JWKS())
+	}
+}
+
+// DIDDocumentHandler handles GET /.well-known/did.json, the did:web document
+// of the broker listing the same keys as the JWKS.
+func DIDDocumentHandler(manager *keys.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/did+json")
+		w.Header().Set("Cache-Control", "max-age=300")
+		json.NewEncoder(w).Encode(manager.DIDDocument())
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/schema"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// verificationProblems gives the status and title for each verification
+// code. Authentication failures are 401, authorization failures 403.
+var verificationProblems = map[vc.Code]struct {
+	status int
+	title  string
+}{
+	vc.CodeSignatureInvalid:    {http.StatusUnauthorized, "Invalid signature"},
+	vc.CodePresentationInvalid: {http.StatusUnauthorized, "Invalid presentation"},
+	vc.CodeChallengeInvalid:    {http.StatusUnauthorized, "Invalid challenge"},
+	vc.CodeIssuerUntrusted:     {http.StatusUnauthorized, "Untrusted issuer"},
+	vc.CodeExpired:             {http.StatusUnauthorized, "Credential expired"},
+	vc.CodeNotYetValid:         {http.StatusUnauthorized, "Credential not yet valid"},
+	vc.CodeRevoked:             {http.StatusUnauthorized, "Credential revoked"},
+	vc.CodeSuspended:           {http.StatusUnauthorized, "Credential suspended"},
+	vc.CodeStatusUnavailable:   {http.StatusUnauthorized, "Credential status unavailable"},
+	vc.CodeChainInvalid:        {http.StatusForbidden, "Invalid delegation chain"},
+	vc.CodeSchemaInvalid:       {http.StatusForbidden, "Schema violation"},
+	vc.CodeRoleMissing:         {http.StatusForbidden, "Role missing"},
+	vc.CodeActionDenied:        {http.StatusForbidden, "Action denied"},
+	vc.CodeCallLimitExceeded:   {http.StatusTooManyRequests, "Call limit exceeded"},
+}
+
+// verificationProblem converts a *vc.VerificationError, or an error
+// wrapping one, into a problem. Other errors become presentation_invalid.
+// Schema failures list the offending fields.
+func verificationProblem(err error) problem.Details {
+	var verr *vc.VerificationError
+	if !errors.As(err, &verr) {
+		verr = &vc.VerificationError{Code: vc.CodePresentationInvalid, Detail: "invalid presentation"}
+	}
+	kind, ok := verificationProblems[verr.Code]
+	if !ok {
+		kind.status, kind.title = http.StatusUnauthorized, "Verification failed"
+	}
+	p := problem.New(kind.status, string(verr.Code), kind.title, verr.Message())
+	var serr *schema.ValidationError
+	if errors.As(err, &serr) {
+		p.Schema = serr.Schema
+		p.Errors = serr.Errors
+	}
+	return p
+}
+
+// writeVerificationError writes the problem for a verification or
+// authorization failure.
+func writeVerificationError(w http.ResponseWriter, err error) {
+	problem.Write(w, verificationProblem(err))
+}
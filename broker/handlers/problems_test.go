@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/bradtumy/agent-identity-poc/internal/capability"
+	"github.com/bradtumy/agent-identity-poc/internal/policy"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+func TestVerificationProblem(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   vc.Code
+	}{
+		{fmt.Errorf("%w: bad kid", vc.ErrInvalidProof), http.StatusUnauthorized, vc.CodeSignatureInvalid},
+		{vc.ErrUntrustedIssuer, http.StatusUnauthorized, vc.CodeIssuerUntrusted},
+		{vc.ErrRevoked, http.StatusUnauthorized, vc.CodeRevoked},
+		{policy.ValidatePolicy("fetch_data", ""), http.StatusForbidden, vc.CodeRoleMissing},
+		{policy.ValidatePolicy("notify", "data-fetcher"), http.StatusForbidden, vc.CodeActionDenied},
+		{capability.ErrExhausted, http.StatusTooManyRequests, vc.CodeCallLimitExceeded},
+		{errors.New("boom"), http.StatusUnauthorized, vc.CodePresentationInvalid},
+	}
+	for _, tc := range tests {
+		p := verificationProblem(tc.err)
+		if p.Status != tc.status || p.Code != string(tc.code) || p.Type != "/problems/"+string(tc.code) {
+			t.Errorf("%v: got %+v", tc.err, p)
+		}
+	}
+}
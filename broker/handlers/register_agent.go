@@ -1,11 +1,16 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/bradtumy/agent-identity-poc/internal/did"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/schema"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
 	"github.com/bradtumy/agent-identity-poc/internal/storage"
 	"github.com/bradtumy/agent-identity-poc/internal/vc"
 )
@@ -14,55 +19,191 @@ import (
 type AgentRequest struct {
 	Role     string `json:"role"`
 	TokenTTL int    `json:"token_ttl"`
+	// HolderKey is the agent's Ed25519 public key. It is bound into the
+	// credential's cnf claim; the agent proves possession of it when
+	// presenting the credential and uses it to sign sub-delegations.
+	HolderKey *vc.JWK `json:"holder_key,omitempty"`
+	// PublicKeyMultibase is the same key as a multicodec ed25519-pub
+	// multibase value ("z6Mk..."), an alternative to HolderKey.
+	PublicKeyMultibase string `json:"public_key_multibase,omitempty"`
+	// Challenge is a nonce from /challenge and Signature the agent key's
+	// Ed25519 signature over it, unpadded base64url. Together they prove the
+	// agent holds the private key.
+	Challenge string `json:"challenge"`
+	Signature string `json:"signature"`
+	// DIDMethod selects the agent identifier: "example" (default) for a
+	// random did:example DID, or "key" for the did:key of the agent key.
+	DIDMethod string `json:"did_method,omitempty"`
+	// Format selects the credential encoding: "ldp_vc", "jwt_vc",
+	// "vc+sd-jwt" or "vc+cose". It defaults to "vc+cose" when the client
+	// accepts application/cbor and to "ldp_vc" otherwise.
+	Format string `json:"format,omitempty"`
 }
 
 // Response contains the issued credential.
 type Response struct {
-	DID        string         `json:"did"`
-	Credential *vc.Credential `json:"credential"`
+	DID    string `json:"did"`
+	Format string `json:"format"`
+	// Credential is a *vc.Credential for ldp_vc and a string for the other
+	// formats; vc+cose credentials are base64url, or a byte string in CBOR
+	// responses.
+	Credential interface{} `json:"credential"`
 }
 
 // RegisterAgentHandler handles POST /register-agent
-func RegisterAgentHandler(store *storage.FileStore, issuer string, signingSecret []byte) http.HandlerFunc {
+func RegisterAgentHandler(store *storage.FileStore, statuses *statuslist.FileStore, schemas *schema.Registry, nonces *nonce.Store, issuer string, signer vc.SignerSource) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// userEmail is set by auth middleware
 		email, ok := r.Context().Value("userEmail").(string)
 		if !ok || email == "" {
-			http.Error(w, "missing user email", http.StatusUnauthorized)
+			problem.Error(w, "missing user email", http.StatusUnauthorized)
 			return
 		}
 
 		var req AgentRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid payload", http.StatusBadRequest)
+		if err := decodeBody(r, &req); err != nil {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
 			return
 		}
 
-		agentDID := did.Generate()
+		if req.TokenTTL <= 0 {
+			problem.Error(w, "token_ttl must be positive", http.StatusBadRequest)
+			return
+		}
+
+		format, ok := issuanceFormat(r, req.Format)
+		if !ok {
+			problem.Error(w, "unsupported credential format", http.StatusBadRequest)
+			return
+		}
 
 		metadata := map[string]interface{}{
-			"role":      req.Role,
-			"token_ttl": req.TokenTTL,
+			"role":  req.Role,
+			"owner": email,
+		}
+
+		holderKey, ok := agentKey(w, req)
+		if !ok {
+			return
+		}
+		agentDID, ok := agentIdentifier(w, req.DIDMethod, holderKey)
+		if !ok {
+			return
+		}
+		if _, exists := store.Get(agentDID); exists {
+			problem.Error(w, "agent already registered; renew its credential instead", http.StatusConflict)
+			return
+		}
+		if req.Challenge == "" || req.Signature == "" {
+			problem.Error(w, "missing challenge or signature", http.StatusBadRequest)
+			return
+		}
+		if err := holderKey.VerifyPossession(req.Challenge, req.Signature); err != nil {
+			writeVerificationError(w, err)
+			return
+		}
+		if err := nonces.Consume(req.Challenge); err != nil {
+			writeVerificationError(w, err)
+			return
+		}
+
+		unsigned := vc.NewDelegation(issuer, agentDID, metadata, time.Duration(req.TokenTTL)*time.Second)
+		unsigned.Cnf = &vc.Confirmation{JWK: holderKey}
+		if !applySchema(w, schemas, unsigned) {
+			return
+		}
+
+		statusIndex, err := statuses.Allocate()
+		if err != nil {
+			log.Printf("status list allocation error: %v", err)
+			problem.Error(w, "failed to issue credential", http.StatusInternalServerError)
+			return
 		}
+		setStatusEntries(unsigned, statuses, statusIndex)
 
-		cred, err := vc.IssueDelegation(issuer, agentDID, metadata, signingSecret)
+		cred, err := vc.Encode(unsigned, format, signer.Current())
 		if err != nil {
 			log.Printf("credential issuance error: %v", err)
-			http.Error(w, "failed to issue credential", http.StatusInternalServerError)
+			problem.Error(w, "failed to issue credential", http.StatusInternalServerError)
 			return
 		}
 
-		err = store.Save(storage.Agent{
-			DID:        agentDID,
-			Owner:      email,
-			Metadata:   metadata,
-			Credential: cred,
+		agent := storage.Agent{
+			DID:           agentDID,
+			Owner:         email,
+			Metadata:      metadata,
+			Credential:    cred,
+			HolderKey:     holderKey,
+			StatusIndex:   &statusIndex,
+			CredentialIDs: []string{unsigned.ID},
+		}
+		if doc, err := storage.InitialDocument(agent); err == nil {
+			agent.DocumentVersions = []storage.DocumentVersion{{VersionID: 1, Updated: time.Now().UTC().Truncate(time.Second), Document: *doc}}
+		}
+		// The DID may have been registered while the credential was issued.
+		err = store.Update(agentDID, func(a *storage.Agent) error {
+			if a.DID != "" {
+				return storage.ErrAgentExists
+			}
+			*a = agent
+			return nil
 		})
+		if errors.Is(err, storage.ErrAgentExists) {
+			problem.Error(w, "agent already registered; renew its credential instead", http.StatusConflict)
+			return
+		}
 		if err != nil {
 			log.Printf("storage error: %v", err)
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(Response{DID: agentDID, Credential: cred})
+		writeBody(w, r, Response{DID: agentDID, Format: format, Credential: cred})
+	}
+}
+
+// agentKey returns the agent key given as holder_key or
+// public_key_multibase, writing a 400 response unless exactly one valid key
+// is present.
+func agentKey(w http.ResponseWriter, req AgentRequest) (*vc.JWK, bool) {
+	switch {
+	case req.HolderKey != nil && req.PublicKeyMultibase != "":
+		problem.Error(w, "holder_key and public_key_multibase are mutually exclusive", http.StatusBadRequest)
+		return nil, false
+	case req.PublicKeyMultibase != "":
+		key, err := vc.JWKFromMultibase(req.PublicKeyMultibase)
+		if err != nil {
+			problem.Error(w, "invalid public_key_multibase", http.StatusBadRequest)
+			return nil, false
+		}
+		return key, true
+	case req.HolderKey != nil:
+		if _, err := req.HolderKey.PublicKey(); err != nil {
+			problem.Error(w, "invalid holder_key", http.StatusBadRequest)
+			return nil, false
+		}
+		return req.HolderKey, true
+	default:
+		problem.Error(w, "missing holder_key or public_key_multibase", http.StatusBadRequest)
+		return nil, false
+	}
+}
+
+// agentIdentifier returns a DID for the agent using the requested method,
+// writing a 400 response for unknown methods.
+func agentIdentifier(w http.ResponseWriter, method string, key *vc.JWK) (string, bool) {
+	switch method {
+	case "", "example":
+		return did.Generate(), true
+	case "key":
+		// agentKey has already validated the key.
+		pub, _ := key.PublicKey()
+		id, err := did.NewKey(pub)
+		if err != nil {
+			problem.Error(w, "cannot derive did:key from agent key", http.StatusBadRequest)
+			return "", false
+		}
+		return id, true
+	default:
+		problem.Error(w, "unsupported did_method", http.StatusBadRequest)
+		return "", false
 	}
 }
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+func TestRegisterAgentProofOfPossession(t *testing.T) {
+	signer, pub := testSigner(t)
+	dir := t.TempDir()
+	store := storage.NewFileStore(filepath.Join(dir, "agents.json"))
+	statuses, err := statuslist.NewFileStore(filepath.Join(dir, "status.json"), "http://localhost:8081")
+	if err != nil {
+		t.Fatalf("status store: %v", err)
+	}
+	nonces := nonce.NewStore(time.Minute)
+	handler := RegisterAgentHandler(store, statuses, testSchemas(), nonces, testIssuer, signer)
+
+	agentPub, agentPriv, _ := ed25519.GenerateKey(nil)
+	multibaseKey, _ := vc.JWKFromEd25519(agentPub).Multibase()
+	register := func(req AgentRequest) *httptest.ResponseRecorder {
+		req.Role, req.TokenTTL = "data-fetcher", 60
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest(http.MethodPost, "/register-agent", bytes.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), "userEmail", "alice@example.com"))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	sign := func(challenge string, key ed25519.PrivateKey) string {
+		return base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(challenge)))
+	}
+
+	for _, req := range []AgentRequest{
+		{HolderKey: vc.JWKFromEd25519(agentPub)},
+		{PublicKeyMultibase: multibaseKey},
+	} {
+		req.Challenge, _, _ = nonces.Issue()
+		req.Signature = sign(req.Challenge, agentPriv)
+		rec := register(req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("register returned %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp Response
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		raw, _ := json.Marshal(resp.Credential)
+		cred, err := vc.ParseCredential(raw, vc.StaticKey(pub))
+		if err != nil {
+			t.Fatalf("parse credential: %v", err)
+		}
+		agent, _ := store.Get(resp.DID)
+		if cred.Cnf.JWK.X != vc.JWKFromEd25519(agentPub).X || agent.HolderKey == nil || agent.HolderKey.X != cred.Cnf.JWK.X {
+			t.Fatalf("agent key not bound: cnf %+v, stored %+v", cred.Cnf.JWK, agent.HolderKey)
+		}
+
+		// The challenge is single use.
+		if rec := register(req); rec.Code != http.StatusUnauthorized || code(rec) != string(vc.CodeChallengeInvalid) {
+			t.Fatalf("replayed challenge returned %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+	challenge, _, _ := nonces.Issue()
+	rec := register(AgentRequest{PublicKeyMultibase: multibaseKey, Challenge: challenge, Signature: sign(challenge, otherPriv)})
+	if rec.Code != http.StatusUnauthorized || code(rec) != string(vc.CodeSignatureInvalid) {
+		t.Fatalf("foreign signature returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := register(AgentRequest{PublicKeyMultibase: multibaseKey}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("missing signature returned %d", rec.Code)
+	}
+
+	// did:key agents are identified by their own key, once.
+	challenge, _, _ = nonces.Issue()
+	rec = register(AgentRequest{PublicKeyMultibase: multibaseKey, Challenge: challenge, Signature: sign(challenge, agentPriv), DIDMethod: "key"})
+	var resp Response
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || resp.DID != "did:key:"+multibaseKey {
+		t.Fatalf("did:key registration returned %d: %s", rec.Code, rec.Body.String())
+	}
+	challenge, _, _ = nonces.Issue()
+	rec = register(AgentRequest{PublicKeyMultibase: multibaseKey, Challenge: challenge, Signature: sign(challenge, agentPriv), DIDMethod: "key"})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("duplicate did:key registration returned %d", rec.Code)
+	}
+}
+
+func code(rec *httptest.ResponseRecorder) string {
+	var p problem.Details
+	json.Unmarshal(rec.Body.Bytes(), &p)
+	return p.Code
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/audit"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/schema"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// ReissueRequest asks for a credential bound to another key of the agent's
+// DID document, such as the key that replaced a rotated-out holder key.
+type ReissueRequest struct {
+	// HolderKey or PublicKeyMultibase is the key to bind. It must be an
+	// authentication key of the current DID document.
+	HolderKey          *vc.JWK `json:"holder_key,omitempty"`
+	PublicKeyMultibase string  `json:"public_key_multibase,omitempty"`
+	// Challenge is a nonce from /challenge and Signature the key's Ed25519
+	// signature over it, unpadded base64url.
+	Challenge string `json:"challenge"`
+	Signature string `json:"signature"`
+	TokenTTL  int    `json:"token_ttl"`
+	Format    string `json:"format,omitempty"`
+}
+
+// ReissueHandler handles POST /agents/{did}/reissue. The owner obtains a
+// credential with the agent's current metadata and status entry, bound to
+// a key of the agent's DID document the agent proves it holds. Credentials
+// bound to a rotated-out key stop verifying, so this is how an agent
+// recovers after key rotation.
+func ReissueHandler(store *storage.FileStore, statuses *statuslist.FileStore, schemas *schema.Registry, issuers vc.IssuerRegistry, nonces *nonce.Store, issuer string, signer vc.SignerSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agent, ok := ownedAgent(w, r, store)
+		if !ok {
+			return
+		}
+		var req ReissueRequest
+		if err := decodeBody(r, &req); err != nil {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		if agent.Deactivated() {
+			audit.LogAction("reissue", agent.DID, false)
+			problem.Error(w, storage.ErrDeactivated.Error(), http.StatusGone)
+			return
+		}
+		if req.TokenTTL <= 0 {
+			problem.Error(w, "token_ttl must be positive", http.StatusBadRequest)
+			return
+		}
+		format, ok := issuanceFormat(r, req.Format)
+		if !ok {
+			problem.Error(w, "unsupported credential format", http.StatusBadRequest)
+			return
+		}
+		holderKey, ok := agentKey(w, AgentRequest{HolderKey: req.HolderKey, PublicKeyMultibase: req.PublicKeyMultibase})
+		if !ok {
+			return
+		}
+		if len(agent.Versions()) == 0 || !agent.HoldsKey(holderKey) {
+			problem.Error(w, "key is not an authentication key of the agent's DID document", http.StatusBadRequest)
+			return
+		}
+		if req.Challenge == "" || req.Signature == "" {
+			problem.Error(w, "missing challenge or signature", http.StatusBadRequest)
+			return
+		}
+		if err := holderKey.VerifyPossession(req.Challenge, req.Signature); err != nil {
+			writeVerificationError(w, err)
+			return
+		}
+		if err := nonces.Consume(req.Challenge); err != nil {
+			writeVerificationError(w, err)
+			return
+		}
+
+		metadata := map[string]interface{}{}
+		for k, v := range agent.Metadata {
+			metadata[k] = v
+		}
+		metadata["owner"] = agent.Owner
+		ttl := time.Duration(req.TokenTTL) * time.Second
+		role, _ := metadata["role"].(string)
+		if max, ok := roleMaxLifetime(issuers, issuer, role); ok && ttl > max {
+			problem.Error(w, fmt.Sprintf("token_ttl exceeds the maximum lifetime of %s for role %s", max, role), http.StatusBadRequest)
+			return
+		}
+
+		unsigned := vc.NewDelegation(issuer, agent.DID, metadata, ttl)
+		unsigned.Cnf = &vc.Confirmation{JWK: holderKey}
+		if !applySchema(w, schemas, unsigned) {
+			return
+		}
+		statusIndex, err := agentStatusIndex(agent, statuses)
+		if err != nil {
+			log.Printf("status list allocation error: %v", err)
+			problem.Error(w, "failed to issue credential", http.StatusInternalServerError)
+			return
+		}
+		setStatusEntries(unsigned, statuses, statusIndex)
+		cred, err := vc.Encode(unsigned, format, signer.Current())
+		if err != nil {
+			log.Printf("credential issuance error: %v", err)
+			problem.Error(w, "failed to issue credential", http.StatusInternalServerError)
+			return
+		}
+
+		err = store.Update(agent.DID, func(a *storage.Agent) error {
+			if a.DID == "" {
+				return storage.ErrAgentNotFound
+			}
+			if a.Deactivated() {
+				return storage.ErrDeactivated
+			}
+			a.CredentialIDs = append(a.CredentialIDs, unsigned.ID)
+			if a.StatusIndex == nil {
+				a.StatusIndex = &statusIndex
+			}
+			a.HolderKey = holderKey
+			a.Credential = cred
+			return nil
+		})
+		if !storedCredential(w, "reissue", agent.DID, err) {
+			return
+		}
+		audit.LogAction("reissue", agent.DID, true)
+
+		writeBody(w, r, Response{DID: agent.DID, Format: format, Credential: cred})
+	}
+}
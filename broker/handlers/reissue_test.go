@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"github.com/gorilla/mux"
+)
+
+func TestReissueAfterKeyRotation(t *testing.T) {
+	const agentDID = "did:example:123"
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, agentDID)
+	metadata := map[string]interface{}{"role": "data-fetcher", "owner": "alice@example.com"}
+	cred := agent.credential(metadata, time.Hour)
+	if err := vc.Sign(cred, signer); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	dir := t.TempDir()
+	store := storage.NewFileStore(filepath.Join(dir, "agents.json"))
+	statuses, err := statuslist.NewFileStore(filepath.Join(dir, "status.json"), "http://localhost:8081")
+	if err != nil {
+		t.Fatalf("status store: %v", err)
+	}
+	idx, _ := statuses.Allocate()
+	store.Save(storage.Agent{DID: agentDID, Owner: "alice@example.com", Metadata: metadata, Credential: cred, HolderKey: agent.jwk, StatusIndex: &idx, CredentialIDs: []string{cred.ID}})
+
+	nonces := nonce.NewStore(time.Minute)
+	verifier := testVerifier(pub, statuses, vc.ValidityChecker{}, 3)
+	verifier.Subjects = store
+	router := mux.NewRouter()
+	router.Handle("/agents/{did}/keys", AgentKeyHandler(store)).Methods(http.MethodPost)
+	router.Handle("/agents/{did}/reissue", ReissueHandler(store, statuses, testSchemas(), verifier.Issuers, nonces, testIssuer, signer)).Methods(http.MethodPost)
+	router.Handle("/execute", ExecuteHandler(verifier, nil, nonces, nil)).Methods(http.MethodPost)
+	call := func(path, owner string, body interface{}) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(raw))
+		r = r.WithContext(context.WithValue(r.Context(), "userEmail", owner))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, r)
+		return rec
+	}
+	execute := func(holder testAgent, credential interface{}) int {
+		b := holder.executeBody(t, nonces, credential, vc.Task{Action: "fetch_data"})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/execute", bytes.NewReader(b)))
+		return rec.Code
+	}
+	reissue := func(owner string, key *vc.JWK, priv ed25519.PrivateKey) *httptest.ResponseRecorder {
+		challenge, _, _ := nonces.Issue()
+		sig := base64.RawURLEncoding.EncodeToString(ed25519.Sign(priv, []byte(challenge)))
+		return call("/agents/"+agentDID+"/reissue", owner, ReissueRequest{HolderKey: key, Challenge: challenge, Signature: sig, TokenTTL: 3600})
+	}
+
+	if code := execute(agent, cred); code != http.StatusOK {
+		t.Fatalf("execute before rotation returned %d", code)
+	}
+	rotated := newTestAgent(t, agentDID)
+	mb, _ := rotated.jwk.Multibase()
+	if rec := call("/agents/"+agentDID+"/keys", "alice@example.com", KeyRequest{PublicKeyMultibase: mb, Replaces: "#key-1"}); rec.Code != http.StatusOK {
+		t.Fatalf("rotate key returned %d: %s", rec.Code, rec.Body.String())
+	}
+	if code := execute(agent, cred); code != http.StatusUnauthorized {
+		t.Fatalf("credential bound to the rotated-out key returned %d", code)
+	}
+
+	if rec := reissue("mallory@example.com", rotated.jwk, rotated.signer.Key); rec.Code != http.StatusForbidden {
+		t.Fatalf("non-owner reissue returned %d", rec.Code)
+	}
+	if rec := reissue("alice@example.com", agent.jwk, agent.signer.Key); rec.Code != http.StatusBadRequest {
+		t.Fatalf("reissue to the rotated-out key returned %d", rec.Code)
+	}
+	if rec := reissue("alice@example.com", rotated.jwk, agent.signer.Key); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("reissue without possession of the new key returned %d", rec.Code)
+	}
+	rec := reissue("alice@example.com", rotated.jwk, rotated.signer.Key)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reissue returned %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Credential json.RawMessage `json:"credential"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	reissued, err := vc.ParseCredential(resp.Credential, vc.StaticKey(pub))
+	if err != nil {
+		t.Fatalf("parse credential: %v", err)
+	}
+	if reissued.Cnf.JWK.X != rotated.jwk.X || len(reissued.CredentialStatus) != 2 || reissued.CredentialStatus[0].StatusListIndex != "0" {
+		t.Fatalf("unexpected credential: cnf %+v, status %+v", reissued.Cnf.JWK, reissued.CredentialStatus)
+	}
+	if code := execute(rotated, resp.Credential); code != http.StatusOK {
+		t.Fatalf("execute with the reissued credential returned %d", code)
+	}
+	if stored, _ := store.Get(agentDID); len(stored.CredentialIDs) != 2 || stored.HolderKey.X != rotated.jwk.X {
+		t.Fatalf("agent record not updated: %+v", stored)
+	}
+}
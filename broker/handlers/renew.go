@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/audit"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/schema"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"github.com/gorilla/mux"
+)
+
+// RenewRequest asks for a fresh credential for an existing agent. The
+// presentation of the current credential over a broker challenge
+// authenticates the agent and proves possession of its holder key.
+type RenewRequest struct {
+	Presentation json.RawMessage `json:"presentation"`
+	// TokenTTL is the new credential's lifetime in seconds. It defaults to
+	// the current credential's lifetime.
+	TokenTTL int `json:"token_ttl,omitempty"`
+	// Metadata optionally narrows the current metadata; role must stay the
+	// same and owner is always carried over.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Format   string                 `json:"format,omitempty"`
+}
+
+// RenewHandler handles POST /agents/{did}/renew. Only credentials issued to
+// the registered agent can be renewed. The new credential keeps the agent's
+// DID and holder key and uses the agent's status list index, so revoking the
+// agent revokes every credential it holds.
+func RenewHandler(store *storage.FileStore, statuses *statuslist.FileStore, schemas *schema.Registry, verifier *vc.Verifier, nonces *nonce.Store, issuer string, signer vc.SignerSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agentDID := mux.Vars(r)["did"]
+		var req RenewRequest
+		if err := decodeBody(r, &req); err != nil {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		current, challenge, err := verifier.VerifyPresentation(req.Presentation)
+		if challenge != "" {
+			if cerr := nonces.Consume(challenge); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			log.Printf("renewal verification failed for %s: %v", agentDID, err)
+			audit.LogAction("renew", agentDID, false)
+			writeVerificationError(w, err)
+			return
+		}
+		if current.CredentialSubject.ID != agentDID || current.ParentCredential != nil {
+			problem.Error(w, "only the agent's broker-issued credential can be renewed", http.StatusForbidden)
+			return
+		}
+		agent, found := store.Get(agentDID)
+		if !found {
+			problem.Error(w, "agent not found", http.StatusNotFound)
+			return
+		}
+		if !issuedToAgent(agent, current) {
+			problem.Error(w, "only the agent's broker-issued credential can be renewed", http.StatusForbidden)
+			return
+		}
+		if agent.Deactivated() {
+			audit.LogAction("renew", agentDID, false)
+			problem.Error(w, "agent DID is deactivated", http.StatusForbidden)
+			return
+		}
+
+		format, ok := issuanceFormat(r, req.Format)
+		if !ok {
+			problem.Error(w, "unsupported credential format", http.StatusBadRequest)
+			return
+		}
+
+		oldMeta := current.CredentialSubject.Metadata
+		metadata := map[string]interface{}{}
+		source := oldMeta
+		if req.Metadata != nil {
+			source = req.Metadata
+		}
+		for k, v := range source {
+			if k != "token_ttl" {
+				metadata[k] = v
+			}
+		}
+		metadata["owner"] = agent.Owner
+		if err := vc.CheckNarrowerMetadata(oldMeta, metadata); err != nil {
+			problem.Error(w, "metadata must be the same or narrower: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ttl := time.Duration(req.TokenTTL) * time.Second
+		if req.TokenTTL == 0 {
+			ttl, err = lifetime(current)
+			if err != nil {
+				problem.Error(w, "cannot determine current credential lifetime", http.StatusBadRequest)
+				return
+			}
+		}
+		if ttl <= 0 {
+			problem.Error(w, "token_ttl must be positive", http.StatusBadRequest)
+			return
+		}
+		role, _ := metadata["role"].(string)
+		max, err := maxLifetime(verifier.Issuers, issuer, role, current)
+		if err != nil {
+			problem.Error(w, "cannot determine current credential lifetime", http.StatusBadRequest)
+			return
+		}
+		if ttl > max {
+			problem.Error(w, fmt.Sprintf("token_ttl exceeds the maximum lifetime of %s for role %s", max, role), http.StatusBadRequest)
+			return
+		}
+
+		unsigned := vc.NewDelegation(issuer, agentDID, metadata, ttl)
+		unsigned.Cnf = current.Cnf
+		if !applySchema(w, schemas, unsigned) {
+			return
+		}
+		statusIndex, err := agentStatusIndex(agent, statuses)
+		if err != nil {
+			log.Printf("status list allocation error: %v", err)
+			problem.Error(w, "failed to issue credential", http.StatusInternalServerError)
+			return
+		}
+		setStatusEntries(unsigned, statuses, statusIndex)
+		cred, err := vc.Encode(unsigned, format, signer.Current())
+		if err != nil {
+			log.Printf("credential issuance error: %v", err)
+			problem.Error(w, "failed to issue credential", http.StatusInternalServerError)
+			return
+		}
+
+		// The record changes only once the new credential exists, and is
+		// re-read so that concurrent document changes are kept.
+		err = store.Update(agentDID, func(a *storage.Agent) error {
+			if a.DID == "" {
+				return storage.ErrAgentNotFound
+			}
+			if a.Deactivated() {
+				return storage.ErrDeactivated
+			}
+			if len(a.CredentialIDs) == 0 {
+				a.CredentialIDs = []string{current.ID}
+			}
+			a.CredentialIDs = append(a.CredentialIDs, unsigned.ID)
+			if a.StatusIndex == nil {
+				a.StatusIndex = &statusIndex
+			}
+			a.Metadata = metadata
+			a.Credential = cred
+			return nil
+		})
+		if !storedCredential(w, "renew", agentDID, err) {
+			return
+		}
+		audit.LogAction("renew", agentDID, true)
+
+		writeBody(w, r, Response{DID: agentDID, Format: format, Credential: cred})
+	}
+}
+
+// storedCredential reports whether a new credential was recorded for the
+// agent, writing an error response if the agent has since been removed or
+// deactivated. Other storage errors are only logged.
+func storedCredential(w http.ResponseWriter, action, agentDID string, err error) bool {
+	switch {
+	case errors.Is(err, storage.ErrAgentNotFound):
+		problem.Error(w, "agent not found", http.StatusNotFound)
+	case errors.Is(err, storage.ErrDeactivated):
+		problem.Error(w, "agent DID is deactivated", http.StatusForbidden)
+	case err != nil:
+		log.Printf("storage error: %v", err)
+		return true
+	default:
+		return true
+	}
+	audit.LogAction(action, agentDID, false)
+	return false
+}
+
+// issuedToAgent reports whether cred was issued to the registered agent: it
+// is one of the agent's recorded credentials or, for agents registered
+// before credentials were recorded, it is bound to the agent's holder key.
+func issuedToAgent(agent storage.Agent, cred *vc.Credential) bool {
+	if len(agent.CredentialIDs) > 0 {
+		return slices.Contains(agent.CredentialIDs, cred.ID)
+	}
+	return agent.HolderKey != nil && cred.Cnf != nil && cred.Cnf.JWK != nil && cred.Cnf.JWK.X == agent.HolderKey.X
+}
+
+// agentStatusIndex returns the agent's status list index, allocating one for
+// agents registered before credentials had status entries. The caller saves
+// it with the agent.
+func agentStatusIndex(agent storage.Agent, statuses *statuslist.FileStore) (int, error) {
+	if agent.StatusIndex != nil {
+		return *agent.StatusIndex, nil
+	}
+	return statuses.Allocate()
+}
+
+// maxLifetime returns the longest lifetime a renewal for role may have: the
+// issuer's configured max_lifetime, or else the current credential's
+// lifetime, so that renewal never extends it unless configured to.
+func maxLifetime(issuers vc.IssuerRegistry, issuer, role string, current *vc.Credential) (time.Duration, error) {
+	if max, ok := roleMaxLifetime(issuers, issuer, role); ok {
+		return max, nil
+	}
+	return lifetime(current)
+}
+
+// roleMaxLifetime returns the issuer's configured max_lifetime for role.
+func roleMaxLifetime(issuers vc.IssuerRegistry, issuer, role string) (time.Duration, bool) {
+	if issuers == nil {
+		return 0, false
+	}
+	trusted, ok := issuers.TrustedIssuer(issuer)
+	if !ok {
+		return 0, false
+	}
+	max, ok := trusted.MaxLifetime[role]
+	return max, ok
+}
+
+// lifetime returns the length of a credential's validity period.
+func lifetime(cred *vc.Credential) (time.Duration, error) {
+	from, err := time.Parse(time.RFC3339, cred.IssuanceDate)
+	if cred.ValidFrom != "" {
+		from, err = time.Parse(time.RFC3339, cred.ValidFrom)
+	}
+	if err != nil {
+		return 0, err
+	}
+	until, err := vc.Expiry(cred)
+	if err != nil {
+		return 0, err
+	}
+	return until.Sub(from), nil
+}
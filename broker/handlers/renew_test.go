@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"github.com/gorilla/mux"
+)
+
+// lifetimeRegistry trusts testIssuer with a maximum data-fetcher lifetime.
+type lifetimeRegistry struct{}
+
+func (lifetimeRegistry) TrustedIssuer(id string) (vc.TrustedIssuer, bool) {
+	return vc.TrustedIssuer{ID: id, MaxLifetime: map[string]time.Duration{"data-fetcher": 2 * time.Hour}}, id == testIssuer
+}
+
+func TestRenewHandler(t *testing.T) {
+	signer, pub := testSigner(t)
+	agent := newTestAgent(t, "did:example:123")
+	cred := agent.credential(map[string]interface{}{"role": "data-fetcher", "owner": "alice@example.com"}, time.Hour)
+	if err := vc.Sign(cred, signer); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	dir := t.TempDir()
+	store := storage.NewFileStore(filepath.Join(dir, "agents.json"))
+	store.Save(storage.Agent{DID: agent.did, Owner: "alice@example.com", Metadata: cred.CredentialSubject.Metadata, Credential: cred, HolderKey: agent.jwk, CredentialIDs: []string{cred.ID}})
+	statuses, err := statuslist.NewFileStore(filepath.Join(dir, "status.json"), "http://localhost:8081")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonces := nonce.NewStore(time.Minute)
+	verifier := testVerifier(pub, nil, vc.ValidityChecker{}, 3)
+	verifier.Issuers = lifetimeRegistry{}
+	router := mux.NewRouter()
+	router.Handle("/agents/{did}/renew", RenewHandler(store, statuses, testSchemas(), verifier, nonces, testIssuer, signer))
+
+	renewCredential := func(cred *vc.Credential, ttl int, metadata map[string]interface{}) *httptest.ResponseRecorder {
+		var presented ExecuteRequest
+		json.Unmarshal(agent.executeBody(t, nonces, cred, vc.Task{}), &presented)
+		body, _ := json.Marshal(RenewRequest{Presentation: presented.Presentation, TokenTTL: ttl, Metadata: metadata})
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/agents/"+agent.did+"/renew", bytes.NewReader(body)))
+		return rec
+	}
+	renew := func(ttl int, metadata map[string]interface{}) *httptest.ResponseRecorder {
+		return renewCredential(cred, ttl, metadata)
+	}
+
+	// A credential for the agent's DID from /delegate was not issued to the
+	// registered agent.
+	delegated := agent.credential(map[string]interface{}{"role": "data-fetcher", "owner": "alice@example.com"}, time.Hour)
+	vc.Sign(delegated, signer)
+	if rec := renewCredential(delegated, 0, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a credential not issued to the agent, got %d", rec.Code)
+	}
+
+	if rec := renew(3*3600, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 beyond the role's max lifetime, got %d", rec.Code)
+	}
+	if rec := renew(0, map[string]interface{}{"role": "admin"}); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a different role, got %d", rec.Code)
+	}
+
+	rec := renew(0, map[string]interface{}{"role": "data-fetcher", "actions": []string{"fetch_data"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("renew returned %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		DID        string        `json:"did"`
+		Credential vc.Credential `json:"credential"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	renewed := resp.Credential
+	if resp.DID != agent.did || renewed.CredentialSubject.ID != agent.did || renewed.ID == cred.ID {
+		t.Fatalf("unexpected renewed credential: %+v", renewed)
+	}
+	if renewed.CredentialSubject.Metadata["owner"] != "alice@example.com" || renewed.Cnf.JWK.X != agent.jwk.X {
+		t.Fatalf("owner or holder key not carried over: %+v", renewed)
+	}
+
+	stored, _ := store.Get(agent.did)
+	if len(stored.CredentialIDs) != 2 || stored.CredentialIDs[0] != cred.ID || stored.CredentialIDs[1] != renewed.ID {
+		t.Fatalf("credential IDs not recorded: %v", stored.CredentialIDs)
+	}
+	// The agent had no status entry, so renewal gives it one.
+	if stored.StatusIndex == nil || len(renewed.CredentialStatus) != 2 || renewed.CredentialStatus[0].StatusListIndex != strconv.Itoa(*stored.StatusIndex) {
+		t.Fatalf("renewed credential has no agent status entry: %+v", renewed.CredentialStatus)
+	}
+
+	// Without a configured max_lifetime, renewal cannot extend the lifetime.
+	verifier.Issuers = vc.TrustedIssuers{testIssuer}
+	if rec := renew(2*3600, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 beyond the current lifetime, got %d", rec.Code)
+	}
+	if rec := renew(1800, nil); rec.Code != http.StatusOK {
+		t.Fatalf("renewal within the current lifetime returned %d", rec.Code)
+	}
+
+	if _, err := store.Deactivate(agent.did); err != nil {
+		t.Fatal(err)
+	}
+	if rec := renew(0, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a deactivated agent, got %d", rec.Code)
+	}
+}
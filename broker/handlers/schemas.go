@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/schema"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"github.com/gorilla/mux"
+)
+
+// SchemaHandler handles GET /schemas/{type}/{version}.
+func SchemaHandler(schemas *schema.Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		raw, ok := schemas.Get(schemas.ID(vars["type"], vars["version"]))
+		if !ok {
+			problem.Error(w, "unknown schema", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(raw)
+	}
+}
+
+// applySchema references the newest schema for the credential's type and
+// validates the unsigned credential against it. Validation failures are
+// written as a 400 schema_invalid problem listing the offending fields.
+func applySchema(w http.ResponseWriter, schemas *schema.Registry, cred *vc.Credential) bool {
+	id, ok := schemas.Latest(cred.Type[len(cred.Type)-1])
+	if !ok {
+		problem.Error(w, "no schema for credential type", http.StatusInternalServerError)
+		return false
+	}
+	cred.CredentialSchema = []vc.SchemaRef{vc.NewSchemaRef(id)}
+	err := vc.ValidateSchemas(cred, schemas)
+	if err == nil {
+		return true
+	}
+	var verr *schema.ValidationError
+	if !errors.As(err, &verr) {
+		problem.Error(w, "schema validation failed", http.StatusInternalServerError)
+		return false
+	}
+	p := verificationProblem(err)
+	p.Status = http.StatusBadRequest
+	problem.Write(w, p)
+	return false
+}
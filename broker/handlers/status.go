@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/bradtumy/agent-identity-poc/internal/audit"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
+	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"github.com/gorilla/mux"
+)
+
+// AgentStatusRequest changes the status of an agent's credential.
+// Action is one of "revoke", "suspend" or "reinstate".
+type AgentStatusRequest struct {
+	Action string `json:"action"`
+}
+
+// AgentStatusResponse reports the current status of an agent's credential.
+type AgentStatusResponse struct {
+	DID       string `json:"did"`
+	Revoked   bool   `json:"revoked"`
+	Suspended bool   `json:"suspended"`
+}
+
+// StatusListHandler handles GET /status/{purpose} and serves the signed
+// BitstringStatusListCredential for that purpose.
+func StatusListHandler(statuses *statuslist.FileStore, issuer string, signer vc.SignerSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		purpose := mux.Vars(r)["purpose"]
+		encoded, err := statuses.Encoded(purpose)
+		if err != nil {
+			problem.Error(w, "status list not found", http.StatusNotFound)
+			return
+		}
+		slc, err := vc.IssueStatusList(issuer, statuses.ListURL(purpose), purpose, encoded, signer.Current())
+		if err != nil {
+			log.Printf("status list signing error: %v", err)
+			problem.Error(w, "failed to sign status list", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		json.NewEncoder(w).Encode(slc)
+	}
+}
+
+// AgentStatusHandler handles POST /agents/{did}/status. Only the owner
+// that registered the agent may change its credential status. Revocation
+// is permanent; suspension can be lifted with "reinstate".
+func AgentStatusHandler(store *storage.FileStore, statuses *statuslist.FileStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		agent, ok := ownedAgent(w, r, store)
+		if !ok {
+			return
+		}
+		agentDID := agent.DID
+		if agent.StatusIndex == nil {
+			problem.Error(w, "credential has no status entry", http.StatusConflict)
+			return
+		}
+		idx := *agent.StatusIndex
+
+		var req AgentStatusRequest
+		if err := decodeBody(r, &req); err != nil {
+			problem.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		switch req.Action {
+		case "revoke":
+			err = statuses.Set(statuslist.PurposeRevocation, idx, true)
+		case "suspend":
+			err = statuses.Set(statuslist.PurposeSuspension, idx, true)
+		case "reinstate":
+			err = statuses.Set(statuslist.PurposeSuspension, idx, false)
+		default:
+			problem.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("status list update error: %v", err)
+			problem.Error(w, "failed to update status", http.StatusInternalServerError)
+			return
+		}
+		audit.LogAction("status:"+req.Action, agentDID, true)
+
+		revoked, _ := statuses.Get(statuslist.PurposeRevocation, idx)
+		suspended, _ := statuses.Get(statuslist.PurposeSuspension, idx)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(AgentStatusResponse{DID: agentDID, Revoked: revoked, Suspended: suspended})
+	}
+}
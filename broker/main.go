@@ -3,42 +3,136 @@ package main
 import (
 	"context"
 	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/base64"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bradtumy/agent-identity-poc/broker/handlers"
 	"github.com/bradtumy/agent-identity-poc/broker/middleware"
+	"github.com/bradtumy/agent-identity-poc/internal/capability"
+	"github.com/bradtumy/agent-identity-poc/internal/did"
 	"github.com/bradtumy/agent-identity-poc/internal/executionlog"
+	"github.com/bradtumy/agent-identity-poc/internal/keys"
+	"github.com/bradtumy/agent-identity-poc/internal/nonce"
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/schema"
+	"github.com/bradtumy/agent-identity-poc/internal/statuslist"
 	"github.com/bradtumy/agent-identity-poc/internal/storage"
+	"github.com/bradtumy/agent-identity-poc/internal/trust"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
 	"github.com/gorilla/mux"
 )
 
 func main() {
 	issuer := getenv("OIDC_ISSUER", "http://keycloak:8080/realms/agent-identity-poc")
 	clientID := getenv("OIDC_CLIENT_ID", "agent-identity-cli")
-	signingSecret := []byte(getenv("BROKER_SIGNING_SECRET", "secret"))
-	keyB64 := getenv("BROKER_ED25519_PRIVATE_KEY", "")
-	var privKey ed25519.PrivateKey
-	if keyB64 != "" {
+	storePath := getenv("STORAGE_PATH", "data/agents.json")
+	logPath := getenv("EXECUTION_LOG_PATH", "/data/execution.log")
+	port := getenv("BROKER_PORT", "8081")
+	brokerURL := getenv("BROKER_URL", "http://localhost:"+port)
+	brokerDID := os.Getenv("BROKER_DID")
+	if brokerDID == "" {
+		derived, err := did.WebFromURL(brokerURL)
+		if err != nil {
+			log.Fatalf("invalid BROKER_URL: %v", err)
+		}
+		brokerDID = derived
+		if !strings.HasPrefix(brokerURL, "https://") {
+			// did:web resolves over HTTPS, so only this broker, which is
+			// handed its own DID, can verify what it issues under it.
+			log.Printf("BROKER_DID %s is derived from a non-HTTPS BROKER_URL and cannot be resolved by other verifiers; set BROKER_URL to the public HTTPS address or BROKER_DID explicitly", brokerDID)
+		}
+	}
+	statusPath := getenv("STATUS_LIST_PATH", "data/status.json")
+	exchangePath := getenv("EXCHANGE_LOG_PATH", "data/exchanges.json")
+	clockSkew, err := time.ParseDuration(getenv("CLOCK_SKEW", "30s"))
+	if err != nil {
+		log.Fatalf("invalid CLOCK_SKEW: %v", err)
+	}
+	challengeTTL, err := time.ParseDuration(getenv("CHALLENGE_TTL", "2m"))
+	if err != nil {
+		log.Fatalf("invalid CHALLENGE_TTL: %v", err)
+	}
+	maxChainDepth, err := strconv.Atoi(getenv("MAX_DELEGATION_DEPTH", "3"))
+	if err != nil {
+		log.Fatalf("invalid MAX_DELEGATION_DEPTH: %v", err)
+	}
+	keyRotation, err := time.ParseDuration(getenv("BROKER_KEY_ROTATION", "720h"))
+	if err != nil {
+		log.Fatalf("invalid BROKER_KEY_ROTATION: %v", err)
+	}
+	keyOverlap, err := time.ParseDuration(getenv("BROKER_KEY_OVERLAP", "168h"))
+	if err != nil {
+		log.Fatalf("invalid BROKER_KEY_OVERLAP: %v", err)
+	}
+	didCacheTTL, err := time.ParseDuration(getenv("DID_CACHE_TTL", "5m"))
+	if err != nil {
+		log.Fatalf("invalid DID_CACHE_TTL: %v", err)
+	}
+	didNegativeTTL, err := time.ParseDuration(getenv("DID_NEGATIVE_CACHE_TTL", "1m"))
+	if err != nil {
+		log.Fatalf("invalid DID_NEGATIVE_CACHE_TTL: %v", err)
+	}
+
+	keystore, err := keys.NewKeystore(getenv("BROKER_KEYSTORE_PATH", "data/keystore.json"), os.Getenv("BROKER_KEYSTORE_PASSPHRASE"))
+	if err != nil {
+		log.Fatalf("keystore init failed: %v", err)
+	}
+	keyManager, err := keys.NewManager(brokerDID, keystore, keyOverlap)
+	if err != nil {
+		log.Fatalf("key manager init failed: %v", err)
+	}
+	// Credentials issued before the broker had a DID name the OIDC issuer
+	// as controller of the signing key.
+	keyManager.Aliases = []string{issuer}
+	if keyB64 := getenv("BROKER_ED25519_PRIVATE_KEY", ""); keyB64 != "" {
 		keyBytes, err := base64.StdEncoding.DecodeString(keyB64)
 		if err != nil {
 			log.Fatalf("invalid ed25519 key: %v", err)
 		}
-		privKey = ed25519.PrivateKey(keyBytes)
-	} else {
-		_, pk, err := ed25519.GenerateKey(nil)
-		if err != nil {
+		if err := keyManager.Import(keys.LegacyKeyID, ed25519.PrivateKey(keyBytes)); err != nil {
+			log.Fatalf("importing ed25519 key failed: %v", err)
+		}
+	}
+	if len(keyManager.Keys()) == 0 {
+		if _, err := keyManager.Rotate(); err != nil {
 			log.Fatalf("key generation failed: %v", err)
 		}
-		privKey = pk
 	}
-	storePath := getenv("STORAGE_PATH", "data/agents.json")
-	logPath := getenv("EXECUTION_LOG_PATH", "/data/execution.log")
-	port := getenv("BROKER_PORT", "8081")
+	if keyRotation > 0 {
+		go keyManager.Run(context.Background(), keyRotation, time.Minute)
+	}
+
+	configPath := getenv("CONFIG_PATH", "config/config.yaml")
+	// The trust registry refers to the broker as ${BROKER_DID}.
+	registry, err := trust.Load(configPath, map[string]string{"BROKER_DID": brokerDID})
+	if err != nil {
+		log.Fatalf("trust registry init failed: %v", err)
+	}
+	go registry.Watch(context.Background(), 10*time.Second)
+
+	capSecret, err := base64.StdEncoding.DecodeString(os.Getenv("BROKER_CAPABILITY_SECRET"))
+	if err != nil {
+		log.Fatalf("invalid BROKER_CAPABILITY_SECRET: %v", err)
+	}
+	if len(capSecret) == 0 {
+		log.Println("BROKER_CAPABILITY_SECRET not set; capability tokens will not survive a restart")
+		capSecret = make([]byte, 32)
+		if _, err := rand.Read(capSecret); err != nil {
+			log.Fatalf("capability secret generation failed: %v", err)
+		}
+	}
+
+	schemas, err := schema.NewRegistry(brokerURL)
+	if err != nil {
+		log.Fatalf("schema registry init failed: %v", err)
+	}
 
 	log.Printf("Checking if OIDC issuer %s is ready...", issuer)
 	if err := waitForOIDCIssuer(issuer, 10); err != nil {
@@ -46,23 +140,105 @@ func main() {
 	}
 
 	store := storage.NewFileStore(storePath)
+	exchanges := storage.NewExchangeLog(exchangePath)
+	statuses, err := statuslist.NewFileStore(statusPath, brokerURL)
+	if err != nil {
+		log.Fatalf("status list init failed: %v", err)
+	}
 
-	auth, err := middleware.NewAuth(context.Background(), issuer, clientID)
+	audiences := strings.Split(getenv("OIDC_AUDIENCE", clientID), ",")
+	var validators []middleware.TokenValidator
+	for _, mode := range strings.Split(getenv("OIDC_TOKEN_VALIDATION", "jwt"), ",") {
+		switch strings.TrimSpace(mode) {
+		case "jwt":
+			v, err := middleware.NewJWTValidator(context.Background(), issuer, audiences)
+			if err != nil {
+				log.Fatalf("auth middleware init failed: %v", err)
+			}
+			validators = append(validators, v)
+		case "introspection":
+			v, err := newIntrospector(issuer, clientID, audiences)
+			if err != nil {
+				log.Fatalf("token introspection init failed: %v", err)
+			}
+			validators = append(validators, v)
+		default:
+			log.Fatalf("invalid OIDC_TOKEN_VALIDATION mode %q", mode)
+		}
+	}
+	auth := middleware.NewAuth(validators...)
+	var authzConfig middleware.AuthorizationConfig
+	if err := registry.DecodeAuthorization(&authzConfig); err != nil {
+		log.Fatalf("authorization config init failed: %v", err)
+	}
+	routePolicy, err := middleware.NewRoutePolicy(authzConfig)
 	if err != nil {
-		log.Fatalf("auth middleware init failed: %v", err)
+		log.Fatalf("authorization config init failed: %v", err)
 	}
 
 	r := mux.NewRouter()
 
 	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		problem.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	})
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, "not found", http.StatusNotFound)
+	})
+
+	didClient := &http.Client{Timeout: 10 * time.Second}
+	methods := did.NewResolver(didClient)
+	// did:example identifiers are the agent DIDs minted by this broker.
+	methods.Drivers["example"] = store
+	if endpoint := os.Getenv("DID_RESOLVER_URL"); endpoint != "" {
+		methods.Fallback = &did.HTTPResolver{Endpoint: endpoint, Client: didClient}
+	}
+	resolver := did.NewCache(methods, didCacheTTL, didNegativeTTL)
 
 	execLogger := executionlog.NewLogger(logPath)
+	nonces := nonce.NewStore(challengeTTL)
+	caps := capability.NewService(capSecret, statuses)
+	verifier := &vc.Verifier{
+		Keys:          vc.KeySets{keyManager, registry, vc.DIDKeys{Resolver: resolver}},
+		Issuers:       registry,
+		Validity:      vc.ValidityChecker{Skew: clockSkew},
+		Statuses:      statuses,
+		Schemas:       schemas,
+		Subjects:      store,
+		MaxChainDepth: maxChainDepth,
+	}
 
-	r.Handle("/register-agent", auth.Middleware(handlers.RegisterAgentHandler(store, issuer, signingSecret))).Methods(http.MethodPost)
-	r.Handle("/delegate", auth.Middleware(handlers.DelegateHandler(issuer, privKey))).Methods(http.MethodPost)
-	r.Handle("/execute", handlers.ExecuteHandler(signingSecret, execLogger)).Methods(http.MethodPost)
+	// protect registers an authenticated route, adding the roles configured
+	// for it to base.
+	protect := func(method, path string, base middleware.Requirement, h http.Handler) {
+		r.Handle(path, auth.Require(routePolicy.Requirement(method, path, base), h)).Methods(method)
+	}
+	// Routes acting for an agent owner identify them by the email claim.
+	owner := middleware.Requirement{Scopes: []string{"email"}}
+	protect(http.MethodPost, "/register-agent", owner, handlers.RegisterAgentHandler(store, statuses, schemas, nonces, brokerDID, keyManager))
+	protect(http.MethodPost, "/delegate", middleware.Requirement{}, handlers.DelegateHandler(store, statuses, schemas, brokerDID, keyManager))
+	protect(http.MethodPost, "/delegate/exchange", owner, handlers.ExchangeHandler(store, exchanges, statuses, verifier, schemas, brokerDID, keyManager))
+	r.Handle("/execute", handlers.ExecuteHandler(verifier, caps, nonces, execLogger)).Methods(http.MethodPost)
+	r.Handle("/capabilities", handlers.CapabilityHandler(verifier, caps, nonces)).Methods(http.MethodPost)
+	r.Handle("/challenge", handlers.ChallengeHandler(nonces)).Methods(http.MethodPost)
+	r.Handle("/agents/{did}/renew", handlers.RenewHandler(store, statuses, schemas, verifier, nonces, brokerDID, keyManager)).Methods(http.MethodPost)
+	protect(http.MethodPost, "/agents/{did}/reissue", owner, handlers.ReissueHandler(store, statuses, schemas, registry, nonces, brokerDID, keyManager))
+	protect(http.MethodPost, "/agents/{did}/keys", owner, handlers.AgentKeyHandler(store))
+	protect(http.MethodPut, "/agents/{did}/services", owner, handlers.AgentServicesHandler(store))
+	protect(http.MethodPost, "/agents/{did}/deactivate", owner, handlers.DeactivateAgentHandler(store, statuses))
+	r.Handle("/1.0/identifiers/{did}", handlers.DIDResolutionHandler(store)).Methods(http.MethodGet)
+	r.Handle("/agents/{did}/aliases", handlers.AliasHandler(store, verifier, nonces)).Methods(http.MethodPost)
+	protect(http.MethodPost, "/agents/{did}/status", owner, handlers.AgentStatusHandler(store, statuses))
+	r.Handle("/status/{purpose}", handlers.StatusListHandler(statuses, brokerDID, keyManager)).Methods(http.MethodGet)
+	r.Handle("/schemas/{type}/{version}", handlers.SchemaHandler(schemas)).Methods(http.MethodGet)
+	r.Handle("/.well-known/jwks.json", handlers.JWKSHandler(keyManager)).Methods(http.MethodGet)
+	r.Handle("/.well-known/did.json", handlers.DIDDocumentHandler(keyManager)).Methods(http.MethodGet)
+
+	for _, route := range routePolicy.Unused() {
+		log.Printf("authorization config: %s matches no authenticated route", route)
+	}
+	for _, route := range routePolicy.Unmapped() {
+		log.Printf("authorization config: authenticated route %s has no entry", route)
+	}
 
 	log.Printf("Delegation Broker running on port %s...\n", port)
 	if err := http.ListenAndServe(":"+port, r); err != nil {
@@ -70,6 +246,28 @@ func main() {
 	}
 }
 
+// newIntrospector configures token introspection from the environment. The
+// endpoint defaults to the one in the issuer's discovery document.
+func newIntrospector(issuer, clientID string, audiences []string) (*middleware.Introspector, error) {
+	cacheTTL, err := time.ParseDuration(getenv("OIDC_INTROSPECTION_CACHE_TTL", "1m"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC_INTROSPECTION_CACHE_TTL: %w", err)
+	}
+	endpoint := os.Getenv("OIDC_INTROSPECTION_URL")
+	if endpoint == "" {
+		if endpoint, err = middleware.IntrospectionEndpoint(context.Background(), issuer); err != nil {
+			return nil, err
+		}
+	}
+	in, err := middleware.NewIntrospector(endpoint, getenv("OIDC_INTROSPECTION_CLIENT_ID", clientID), os.Getenv("OIDC_INTROSPECTION_CLIENT_SECRET"), audiences, cacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	in.Issuer = issuer
+	in.Client = &http.Client{Timeout: 10 * time.Second}
+	return in, nil
+}
+
 // waitForOIDCIssuer polls the OIDC metadata endpoint until it’s ready.
 func waitForOIDCIssuer(issuer string, retries int) error {
 	url := issuer + "/.well-known/openid-configuration"
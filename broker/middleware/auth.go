@@ -2,51 +2,228 @@ package middleware
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
 	"github.com/coreos/go-oidc/v3/oidc"
 )
 
-// Auth holds an OIDC ID token verifier.
+// TokenValidator turns a bearer access token into the principal it
+// describes.
+type TokenValidator interface {
+	Validate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Auth authenticates requests with bearer access tokens. Each validator is
+// tried in turn, so JWT verification can fall back to introspection for
+// opaque tokens.
 type Auth struct {
-	verifier *oidc.IDTokenVerifier
+	validators []TokenValidator
+}
+
+// JWTValidator validates JWT access tokens (RFC 9068) from an OIDC provider
+// locally.
+type JWTValidator struct {
+	verifier  *oidc.IDTokenVerifier
+	audiences []string
 }
 
-// NewAuth creates the middleware with given issuer URL.
-func NewAuth(ctx context.Context, issuer string, clientID string) (*Auth, error) {
+// Principal is the caller described by a validated access token.
+type Principal struct {
+	Subject  string
+	Email    string
+	ClientID string
+	Scopes   []string
+	// Roles are the realm roles in realm_access.roles.
+	Roles []string
+	// ClientRoles maps client IDs to the roles in resource_access.
+	ClientRoles map[string][]string
+}
+
+// HasScope reports whether the token was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// HasRole reports whether the caller has the realm role.
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// Requirement is what a route needs from the access token: every scope in
+// Scopes, every realm role in Roles and every client role in ClientRoles.
+type Requirement struct {
+	Scopes      []string
+	Roles       []string
+	ClientRoles map[string][]string
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the principal stored by Auth in ctx.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// NewAuth creates the middleware. A token is accepted by the first of
+// validators that accepts it.
+func NewAuth(validators ...TokenValidator) *Auth {
+	return &Auth{validators: validators}
+}
+
+// NewJWTValidator creates a validator for tokens issued by issuer. A token's
+// aud claim must name at least one of audiences.
+func NewJWTValidator(ctx context.Context, issuer string, audiences []string) (*JWTValidator, error) {
 	provider, err := oidc.NewProvider(ctx, issuer)
 	if err != nil {
 		return nil, err
 	}
-	cfg := &oidc.Config{SkipClientIDCheck: true}
-	return &Auth{verifier: provider.Verifier(cfg)}, nil
+	return newJWTValidator(provider.Verifier(&oidc.Config{SkipClientIDCheck: true}), audiences)
+}
+
+func newJWTValidator(verifier *oidc.IDTokenVerifier, audiences []string) (*JWTValidator, error) {
+	if len(audiences) == 0 {
+		return nil, fmt.Errorf("at least one audience is required")
+	}
+	return &JWTValidator{verifier: verifier, audiences: audiences}, nil
 }
 
-// Middleware verifies bearer tokens and injects claims into the context.
+// Middleware validates the bearer access token and injects the principal
+// into the context.
 func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return a.Require(Requirement{}, next)
+}
+
+// Require is Middleware for a route that also needs the scopes and roles in
+// req. Missing ones are rejected with 403 naming the first one missing.
+func (a *Auth) Require(req Requirement, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
 		if !strings.HasPrefix(auth, "Bearer ") {
-			http.Error(w, "missing token", http.StatusUnauthorized)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			problem.Error(w, "missing token", http.StatusUnauthorized)
 			return
 		}
-		raw := strings.TrimPrefix(auth, "Bearer ")
-		idToken, err := a.verifier.Verify(r.Context(), raw)
+		p, err := a.validate(r.Context(), strings.TrimPrefix(auth, "Bearer "))
 		if err != nil {
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			problem.Error(w, "invalid token: "+err.Error(), http.StatusUnauthorized)
 			return
 		}
-		var claims struct {
-			Email string `json:"email"`
-			Scope string `json:"scope"`
+		for _, scope := range req.Scopes {
+			if !p.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(req.Scopes, " ")))
+				problem.Error(w, "missing scope "+scope, http.StatusForbidden)
+				return
+			}
 		}
-		if err := idToken.Claims(&claims); err != nil {
-			http.Error(w, "invalid claims", http.StatusUnauthorized)
+		if missing := req.missingRole(p); missing != "" {
+			forbidRole(w, missing)
 			return
 		}
-		ctx := context.WithValue(r.Context(), "userEmail", claims.Email)
-		ctx = context.WithValue(ctx, "scope", claims.Scope)
+		ctx := context.WithValue(r.Context(), principalKey{}, p)
+		ctx = context.WithValue(ctx, "userEmail", p.Email)
+		ctx = context.WithValue(ctx, "scope", strings.Join(p.Scopes, " "))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// accessTokenClaims are the claims read from an access token.
+type accessTokenClaims struct {
+	Typ         string `json:"typ"`
+	Email       string `json:"email"`
+	Scope       string `json:"scope"`
+	ClientID    string `json:"client_id"`
+	AZP         string `json:"azp"`
+	RealmAccess struct {
+		Roles []string `json:"roles"`
+	} `json:"realm_access"`
+	ResourceAccess map[string]struct {
+		Roles []string `json:"roles"`
+	} `json:"resource_access"`
+}
+
+// validate returns the principal from the first validator accepting the
+// token, or every validator's reason for rejecting it.
+func (a *Auth) validate(ctx context.Context, raw string) (*Principal, error) {
+	if len(a.validators) == 0 {
+		return nil, fmt.Errorf("no token validators configured")
+	}
+	var reasons []string
+	for _, v := range a.validators {
+		p, err := v.Validate(ctx, raw)
+		if err == nil {
+			return p, nil
+		}
+		reasons = append(reasons, err.Error())
+	}
+	return nil, errors.New(strings.Join(reasons, "; "))
+}
+
+// Validate checks the token's signature, issuer and expiry, that it is an
+// access token and not an ID token, and its audience.
+func (v *JWTValidator) Validate(ctx context.Context, raw string) (*Principal, error) {
+	tok, err := v.verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	var claims accessTokenClaims
+	if err := tok.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	if !isAccessToken(raw, claims.Typ) {
+		return nil, fmt.Errorf("not an access token")
+	}
+	if !slices.ContainsFunc(tok.Audience, func(aud string) bool { return slices.Contains(v.audiences, aud) }) {
+		return nil, fmt.Errorf("audience %v not accepted", tok.Audience)
+	}
+	return claims.principal(tok.Subject), nil
+}
+
+// principal describes the caller with the claims.
+func (c accessTokenClaims) principal(subject string) *Principal {
+	p := &Principal{
+		Subject:     subject,
+		Email:       c.Email,
+		ClientID:    c.ClientID,
+		Scopes:      strings.Fields(c.Scope),
+		Roles:       c.RealmAccess.Roles,
+		ClientRoles: map[string][]string{},
+	}
+	if p.ClientID == "" {
+		p.ClientID = c.AZP
+	}
+	for client, access := range c.ResourceAccess {
+		p.ClientRoles[client] = access.Roles
+	}
+	return p
+}
+
+// isAccessToken accepts the RFC 9068 typ header "at+jwt". Keycloak marks its
+// access tokens with a "typ": "Bearer" claim instead, and ID tokens with
+// "ID".
+func isAccessToken(raw, typClaim string) bool {
+	header, _, _ := strings.Cut(raw, ".")
+	b, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Typ string `json:"typ"`
+	}
+	if json.Unmarshal(b, &h) != nil {
+		return false
+	}
+	switch strings.ToLower(h.Typ) {
+	case "at+jwt", "application/at+jwt":
+		return true
+	}
+	return typClaim == "Bearer"
+}
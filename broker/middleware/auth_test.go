@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/trust"
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+const testIssuer = "https://idp.example/realms/test"
+
+// testIdP signs ES256 tokens for testIssuer.
+type testIdP struct {
+	key *ecdsa.PrivateKey
+}
+
+func (idp testIdP) token(t *testing.T, typ string, claims map[string]interface{}) string {
+	t.Helper()
+	header := map[string]string{"alg": "ES256"}
+	if typ != "" {
+		header["typ"] = typ
+	}
+	body := map[string]interface{}{"iss": testIssuer, "sub": "user-1", "exp": time.Now().Add(time.Minute).Unix()}
+	for k, v := range claims {
+		body[k] = v
+	}
+	h, _ := json.Marshal(header)
+	b, _ := json.Marshal(body)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(b)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, idp.key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newTestJWTValidator(t *testing.T) (*JWTValidator, testIdP) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keySet := &oidc.StaticKeySet{PublicKeys: []crypto.PublicKey{&key.PublicKey}}
+	verifier := oidc.NewVerifier(testIssuer, keySet, &oidc.Config{SkipClientIDCheck: true, SupportedSigningAlgs: []string{oidc.ES256}})
+	v, err := newJWTValidator(verifier, []string{"broker"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v, testIdP{key: key}
+}
+
+func newTestAuth(t *testing.T) (*Auth, testIdP) {
+	t.Helper()
+	v, idp := newTestJWTValidator(t)
+	return NewAuth(v), idp
+}
+
+func TestAccessTokenValidation(t *testing.T) {
+	a, idp := newTestAuth(t)
+	var got *Principal
+	handler := a.Require(Requirement{Scopes: []string{"email"}, Roles: []string{"agent_creator"}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFrom(r.Context())
+	}))
+	call := func(token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/register-agent", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"aud":          []string{"account", "broker"},
+			"scope":        "openid email profile",
+			"email":        "alice@example.com",
+			"azp":          "agent-identity-cli",
+			"realm_access": map[string]interface{}{"roles": []string{"agent_creator"}},
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	rec := call(idp.token(t, "at+jwt", claims(nil)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid access token rejected: %d %s", rec.Code, rec.Body.String())
+	}
+	if got.Email != "alice@example.com" || got.ClientID != "agent-identity-cli" || !got.HasScope("profile") || !got.HasRole("agent_creator") {
+		t.Fatalf("unexpected principal %+v", got)
+	}
+	// Keycloak access tokens carry typ in the claims.
+	if rec := call(idp.token(t, "JWT", claims(map[string]interface{}{"typ": "Bearer"}))); rec.Code != http.StatusOK {
+		t.Fatalf("keycloak access token rejected: %d", rec.Code)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"id token", idp.token(t, "JWT", claims(map[string]interface{}{"typ": "ID"})), http.StatusUnauthorized},
+		{"untyped token", idp.token(t, "", claims(nil)), http.StatusUnauthorized},
+		{"other audience", idp.token(t, "at+jwt", claims(map[string]interface{}{"aud": "account"})), http.StatusUnauthorized},
+		{"expired", idp.token(t, "at+jwt", claims(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})), http.StatusUnauthorized},
+		{"other issuer", idp.token(t, "at+jwt", claims(map[string]interface{}{"iss": "https://evil.example"})), http.StatusUnauthorized},
+		{"missing scope", idp.token(t, "at+jwt", claims(map[string]interface{}{"scope": "openid"})), http.StatusForbidden},
+		{"missing role", idp.token(t, "at+jwt", claims(map[string]interface{}{"realm_access": map[string]interface{}{"roles": []string{}}})), http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		if rec := call(tc.token); rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.name, rec.Code, tc.status)
+		}
+	}
+
+	// Tampering breaks the signature.
+	tok := idp.token(t, "at+jwt", claims(nil))
+	parts := strings.Split(tok, ".")
+	forged, _ := json.Marshal(claims(map[string]interface{}{"iss": testIssuer, "sub": "admin", "exp": time.Now().Add(time.Hour).Unix()}))
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	if rec := call(strings.Join(parts, ".")); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("forged token accepted: %d", rec.Code)
+	}
+	if rec := call(""); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("missing token: %d", rec.Code)
+	}
+}
+
+func TestRoutePolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+trusted_issuers: []
+authorization:
+  routes:
+    - path: /register-agent
+      method: POST
+      roles: [agent_creator]
+    - path: /delegate
+      client_roles:
+        broker: [delegator]
+        admin: [delegator]
+    - path: /typo
+      roles: [x]
+`), 0644)
+	reg, err := trust.Load(path, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	var cfg AuthorizationConfig
+	if err := reg.DecodeAuthorization(&cfg); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	policy, err := NewRoutePolicy(cfg)
+	if err != nil {
+		t.Fatalf("policy: %v", err)
+	}
+	a, idp := newTestAuth(t)
+	ok := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	register := a.Require(policy.Requirement(http.MethodPost, "/register-agent", Requirement{Scopes: []string{"email"}}), ok)
+	delegate := a.Require(policy.Requirement(http.MethodPost, "/delegate", Requirement{}), ok)
+	if unused := policy.Unused(); len(unused) != 1 || unused[0] != "/typo" {
+		t.Fatalf("unused routes = %v", unused)
+	}
+	policy.Requirement(http.MethodPost, "/unmapped", Requirement{})
+	if unmapped := policy.Unmapped(); len(unmapped) != 1 || unmapped[0] != "POST /unmapped" {
+		t.Fatalf("unmapped routes = %v", unmapped)
+	}
+
+	call := func(h http.Handler, roles []string, clientRoles map[string]interface{}) *httptest.ResponseRecorder {
+		tok := idp.token(t, "at+jwt", map[string]interface{}{
+			"aud":             "broker",
+			"scope":           "email",
+			"realm_access":    map[string]interface{}{"roles": roles},
+			"resource_access": clientRoles,
+		})
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+tok)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := call(register, []string{"other"}, nil)
+	var p problem.Details
+	json.Unmarshal(rec.Body.Bytes(), &p)
+	if rec.Code != http.StatusForbidden || p.Code != "role_missing" || !strings.Contains(p.Detail, "agent_creator") {
+		t.Fatalf("missing realm role: %d %+v", rec.Code, p)
+	}
+	if rec := call(register, []string{"agent_creator"}, nil); rec.Code != http.StatusOK {
+		t.Fatalf("agent_creator rejected: %d", rec.Code)
+	}
+	// Missing client roles are reported in client order.
+	for range 5 {
+		rec = call(delegate, []string{"agent_creator"}, map[string]interface{}{"other": map[string]interface{}{"roles": []string{"delegator"}}})
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		if rec.Code != http.StatusForbidden || !strings.Contains(p.Detail, "admin/delegator") {
+			t.Fatalf("missing client role: %d %+v", rec.Code, p)
+		}
+	}
+	rec = call(delegate, nil, map[string]interface{}{"admin": map[string]interface{}{"roles": []string{"delegator"}}})
+	json.Unmarshal(rec.Body.Bytes(), &p)
+	if rec.Code != http.StatusForbidden || !strings.Contains(p.Detail, "broker/delegator") {
+		t.Fatalf("missing second client role: %d %+v", rec.Code, p)
+	}
+	if rec := call(delegate, nil, map[string]interface{}{"admin": map[string]interface{}{"roles": []string{"delegator"}}, "broker": map[string]interface{}{"roles": []string{"delegator"}}}); rec.Code != http.StatusOK {
+		t.Fatalf("client role rejected: %d", rec.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/bradtumy/agent-identity-poc/internal/problem"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// RouteConfig lists the roles a route requires, in the authorization
+// section of config/config.yaml.
+type RouteConfig struct {
+	// Path is the route template, e.g. /agents/{did}/status.
+	Path string `yaml:"path"`
+	// Method defaults to any method.
+	Method string `yaml:"method"`
+	// Roles are realm roles (realm_access.roles).
+	Roles []string `yaml:"roles"`
+	// ClientRoles maps client IDs to roles in resource_access.
+	ClientRoles map[string][]string `yaml:"client_roles"`
+}
+
+// RoutePolicy maps routes to the roles they require.
+type RoutePolicy struct {
+	routes   []RouteConfig
+	used     map[int]bool
+	unmapped []string
+}
+
+// AuthorizationConfig is the authorization section of config/config.yaml.
+type AuthorizationConfig struct {
+	Routes []RouteConfig `yaml:"routes"`
+}
+
+// NewRoutePolicy creates a RoutePolicy for the configured routes.
+func NewRoutePolicy(cfg AuthorizationConfig) (*RoutePolicy, error) {
+	for _, rc := range cfg.Routes {
+		if !strings.HasPrefix(rc.Path, "/") {
+			return nil, fmt.Errorf("authorization route %q must start with /", rc.Path)
+		}
+	}
+	return &RoutePolicy{routes: cfg.Routes, used: map[int]bool{}}, nil
+}
+
+// Requirement adds the roles configured for method and path to base. A nil
+// policy adds nothing.
+func (p *RoutePolicy) Requirement(method, path string, base Requirement) Requirement {
+	if p == nil {
+		return base
+	}
+	req := base
+	req.Roles = slices.Clone(base.Roles)
+	req.ClientRoles = map[string][]string{}
+	for client, roles := range base.ClientRoles {
+		req.ClientRoles[client] = slices.Clone(roles)
+	}
+	matched := false
+	for i, rc := range p.routes {
+		if rc.Path != path || (rc.Method != "" && !strings.EqualFold(rc.Method, method)) {
+			continue
+		}
+		matched = true
+		p.used[i] = true
+		req.Roles = append(req.Roles, rc.Roles...)
+		for client, roles := range rc.ClientRoles {
+			req.ClientRoles[client] = append(req.ClientRoles[client], roles...)
+		}
+	}
+	if !matched {
+		p.unmapped = append(p.unmapped, method+" "+path)
+	}
+	return req
+}
+
+// Unmapped returns the routes Requirement was called for that no configured
+// route matches, which get only their base requirement.
+func (p *RoutePolicy) Unmapped() []string {
+	if p == nil {
+		return nil
+	}
+	return p.unmapped
+}
+
+// Unused returns the configured routes no Requirement call has matched, so
+// that typos and roles on unauthenticated routes can be reported.
+func (p *RoutePolicy) Unused() []string {
+	if p == nil {
+		return nil
+	}
+	var out []string
+	for i, rc := range p.routes {
+		if !p.used[i] {
+			out = append(out, strings.TrimSpace(rc.Method+" "+rc.Path))
+		}
+	}
+	return out
+}
+
+// missingRole names the first role in req the principal lacks, or "".
+func (req Requirement) missingRole(p *Principal) string {
+	for _, role := range req.Roles {
+		if !p.HasRole(role) {
+			return "realm role " + role
+		}
+	}
+	// Clients are checked in a fixed order so that the same role is named
+	// on every request.
+	for _, client := range slices.Sorted(maps.Keys(req.ClientRoles)) {
+		for _, role := range req.ClientRoles[client] {
+			if !slices.Contains(p.ClientRoles[client], role) {
+				return "client role " + client + "/" + role
+			}
+		}
+	}
+	return ""
+}
+
+// forbidRole writes the 403 response for a missing role.
+func forbidRole(w http.ResponseWriter, missing string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+	problem.Write(w, problem.New(http.StatusForbidden, string(vc.CodeRoleMissing), "Role missing", "missing "+missing))
+}
@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+)
+
+// maxIntrospectionEntries bounds the introspection cache; expired entries
+// are dropped first.
+const maxIntrospectionEntries = 1024
+
+// maxIntrospectionResponse bounds the size of an introspection response.
+const maxIntrospectionResponse = 1 << 20
+
+// errInactive is returned for tokens the authorization server reports as
+// inactive.
+var errInactive = errors.New("token is not active")
+
+// Introspector validates access tokens, opaque or not, by asking the
+// authorization server (RFC 7662). It authenticates with client credentials
+// and caches each answer for CacheTTL, or until the token expires if that
+// is sooner. Failures to reach the server are not cached.
+type Introspector struct {
+	Endpoint     string
+	ClientID     string
+	ClientSecret string
+	// Audiences are the accepted aud values, as for JWTValidator.
+	Audiences []string
+	// Issuer, if set, must match the response's iss.
+	Issuer   string
+	CacheTTL time.Duration
+	Client   *http.Client
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]introspection
+}
+
+type introspection struct {
+	principal *Principal
+	err       error
+	expires   time.Time
+}
+
+// introspectionResponse is an RFC 7662 response. Keycloak also returns the
+// access token's claims, such as email and realm_access.
+type introspectionResponse struct {
+	Active   bool     `json:"active"`
+	Subject  string   `json:"sub"`
+	Issuer   string   `json:"iss"`
+	Expiry   int64    `json:"exp"`
+	Audience audience `json:"aud"`
+	accessTokenClaims
+}
+
+// audience is an aud member, which may be a string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		*a = audience{s}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// NewIntrospector creates an Introspector for endpoint that authenticates as
+// clientID.
+func NewIntrospector(endpoint, clientID, clientSecret string, audiences []string, cacheTTL time.Duration) (*Introspector, error) {
+	if len(audiences) == 0 {
+		return nil, fmt.Errorf("at least one audience is required")
+	}
+	if endpoint == "" || clientID == "" {
+		return nil, fmt.Errorf("introspection endpoint and client ID are required")
+	}
+	return &Introspector{
+		Endpoint:     endpoint,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Audiences:    audiences,
+		CacheTTL:     cacheTTL,
+		now:          time.Now,
+		entries:      map[[sha256.Size]byte]introspection{},
+	}, nil
+}
+
+// IntrospectionEndpoint returns the introspection_endpoint advertised in
+// issuer's discovery document.
+func IntrospectionEndpoint(ctx context.Context, issuer string) (string, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return "", err
+	}
+	var meta struct {
+		IntrospectionEndpoint string `json:"introspection_endpoint"`
+	}
+	if err := provider.Claims(&meta); err != nil {
+		return "", err
+	}
+	if meta.IntrospectionEndpoint == "" {
+		return "", fmt.Errorf("issuer %s does not advertise an introspection endpoint", issuer)
+	}
+	return meta.IntrospectionEndpoint, nil
+}
+
+// Validate implements TokenValidator.
+func (in *Introspector) Validate(ctx context.Context, raw string) (*Principal, error) {
+	// Tokens are bearer secrets, so only their hashes are kept.
+	key := sha256.Sum256([]byte(raw))
+	now := in.now()
+	in.mu.Lock()
+	e, ok := in.entries[key]
+	in.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.principal, e.err
+	}
+
+	resp, err := in.introspect(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	p, err := in.principal(resp, now)
+	expires := now.Add(in.CacheTTL)
+	if err == nil && resp.Expiry != 0 {
+		if exp := time.Unix(resp.Expiry, 0); exp.Before(expires) {
+			expires = exp
+		}
+	}
+	if expires.After(now) {
+		in.mu.Lock()
+		in.evict(now)
+		in.entries[key] = introspection{principal: p, err: err, expires: expires}
+		in.mu.Unlock()
+	}
+	return p, err
+}
+
+// introspect sends the token to the introspection endpoint.
+func (in *Introspector) introspect(ctx context.Context, raw string) (*introspectionResponse, error) {
+	form := url.Values{"token": {raw}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, in.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(in.ClientID), url.QueryEscape(in.ClientSecret))
+	client := in.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection failed: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned %d", res.StatusCode)
+	}
+	var resp introspectionResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxIntrospectionResponse)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("invalid introspection response: %w", err)
+	}
+	return &resp, nil
+}
+
+// principal checks an introspection response the way JWTValidator checks
+// a token's claims.
+func (in *Introspector) principal(resp *introspectionResponse, now time.Time) (*Principal, error) {
+	if !resp.Active {
+		return nil, errInactive
+	}
+	if resp.Expiry != 0 && !now.Before(time.Unix(resp.Expiry, 0)) {
+		return nil, errInactive
+	}
+	if in.Issuer != "" && resp.Issuer != in.Issuer {
+		return nil, fmt.Errorf("issuer %q not accepted", resp.Issuer)
+	}
+	// Keycloak reports the token's typ; refresh and ID tokens are also
+	// active but are not access tokens.
+	if resp.Typ != "" && resp.Typ != "Bearer" {
+		return nil, fmt.Errorf("not an access token")
+	}
+	if !slices.ContainsFunc(resp.Audience, func(aud string) bool { return slices.Contains(in.Audiences, aud) }) {
+		return nil, fmt.Errorf("audience %v not accepted", []string(resp.Audience))
+	}
+	return resp.principal(resp.Subject), nil
+}
+
+// evict makes room for one entry and must be called with in.mu held.
+func (in *Introspector) evict(now time.Time) {
+	if len(in.entries) < maxIntrospectionEntries {
+		return
+	}
+	for key, e := range in.entries {
+		if !now.Before(e.expires) {
+			delete(in.entries, key)
+		}
+	}
+	for key := range in.entries {
+		if len(in.entries) < maxIntrospectionEntries {
+			return
+		}
+		delete(in.entries, key)
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIntrospection(t *testing.T) {
+	now := time.Now()
+	responses := map[string]map[string]interface{}{
+		"opaque-alice": {
+			"active":       true,
+			"sub":          "user-1",
+			"aud":          "broker",
+			"scope":        "openid email",
+			"email":        "alice@example.com",
+			"client_id":    "agent-identity-cli",
+			"realm_access": map[string]interface{}{"roles": []string{"agent_creator"}},
+			"exp":          now.Add(time.Hour).Unix(),
+		},
+		"opaque-short":   {"active": true, "aud": []string{"broker"}, "scope": "email", "exp": now.Add(10 * time.Second).Unix()},
+		"opaque-revoked": {"active": false},
+		"opaque-refresh": {"active": true, "aud": "broker", "typ": "Refresh"},
+		"opaque-other":   {"active": true, "aud": "account"},
+	}
+	responses["opaque-new"] = responses["opaque-alice"]
+	var calls atomic.Int32
+	var failing atomic.Bool
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "broker" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		resp, ok := responses[r.PostFormValue("token")]
+		if !ok {
+			resp = map[string]interface{}{"active": false}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer stub.Close()
+
+	in, err := NewIntrospector(stub.URL, "broker", "s3cret", []string{"broker"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := now
+	in.now = func() time.Time { return clock }
+	jwt, idp := newTestJWTValidator(t)
+	a := NewAuth(jwt, in)
+
+	var got *Principal
+	handler := a.Require(Requirement{Scopes: []string{"email"}}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFrom(r.Context())
+	}))
+	call := func(token string) int {
+		r := httptest.NewRequest(http.MethodPost, "/register-agent", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	// JWTs are verified locally without introspection.
+	if code := call(idp.token(t, "at+jwt", map[string]interface{}{"aud": "broker", "scope": "email"})); code != http.StatusOK || calls.Load() != 0 {
+		t.Fatalf("jwt: status %d after %d introspections", code, calls.Load())
+	}
+
+	if code := call("opaque-alice"); code != http.StatusOK {
+		t.Fatalf("opaque token rejected: %d", code)
+	}
+	if got.Email != "alice@example.com" || got.Subject != "user-1" || !got.HasRole("agent_creator") {
+		t.Fatalf("unexpected principal %+v", got)
+	}
+	call("opaque-alice")
+	if calls.Load() != 1 {
+		t.Fatalf("cached token introspected %d times", calls.Load())
+	}
+	clock = now.Add(2 * time.Minute)
+	call("opaque-alice")
+	if calls.Load() != 2 {
+		t.Fatalf("token not introspected again after the cache TTL")
+	}
+
+	// A token is cached no longer than it lives.
+	clock = now
+	if code := call("opaque-short"); code != http.StatusOK {
+		t.Fatalf("short-lived token rejected: %d", code)
+	}
+	clock = now.Add(11 * time.Second)
+	if code := call("opaque-short"); code != http.StatusUnauthorized || calls.Load() != 4 {
+		t.Fatalf("expired token: status %d after %d introspections", code, calls.Load())
+	}
+
+	for _, token := range []string{"opaque-revoked", "opaque-refresh", "opaque-other", "unknown"} {
+		if code := call(token); code != http.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", token, code)
+		}
+	}
+	before := calls.Load()
+	call("opaque-revoked")
+	if calls.Load() != before {
+		t.Fatalf("inactive token not cached")
+	}
+
+	// Server failures are not cached.
+	failing.Store(true)
+	if code := call("opaque-new"); code != http.StatusUnauthorized {
+		t.Fatalf("unavailable introspection: status %d", code)
+	}
+	failing.Store(false)
+	if code := call("opaque-new"); code != http.StatusOK {
+		t.Fatalf("failure was cached: status %d", code)
+	}
+
+	in.ClientSecret = "wrong"
+	if _, err := in.Validate(t.Context(), "opaque-unseen"); err == nil {
+		t.Fatalf("introspection with wrong client credentials succeeded")
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/coreos/go-oidc/v3 v3.6.0
 	github.com/google/uuid v1.5.0
 	github.com/gorilla/mux v1.8.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,176 @@
+package capability
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// holderCredential returns a credential bound to a new holder key.
+func holderCredential(t *testing.T, metadata map[string]interface{}) (*vc.Credential, ed25519.PrivateKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	cred := vc.NewDelegation("did:example:issuer", "did:example:agent", metadata, time.Hour)
+	cred.Cnf = &vc.Confirmation{JWK: vc.JWKFromEd25519(pub)}
+	return cred, priv
+}
+
+func mint(t *testing.T, s *Service) string {
+	t.Helper()
+	cred, _ := holderCredential(t, map[string]interface{}{"role": "data-fetcher"})
+	token, _, err := s.Mint(cred)
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	return token
+}
+
+func TestAttenuation(t *testing.T) {
+	s := NewService([]byte("secret"), nil)
+	token := mint(t, s)
+	fetch := vc.Task{Action: "fetch_data", Params: map[string]interface{}{"url": "https://api.internal/users"}}
+
+	narrowed, err := Attenuate(token, "action=fetch_data", "url prefix=https://api.internal/")
+	if err != nil {
+		t.Fatalf("attenuate: %v", err)
+	}
+	g, err := s.Verify(narrowed, fetch)
+	if err != nil {
+		t.Fatalf("attenuated token rejected: %v", err)
+	}
+	if g.Subject != "did:example:agent" || g.Role != "data-fetcher" {
+		t.Fatalf("unexpected identifier: %+v", g.Identifier)
+	}
+
+	other := vc.Task{Action: "fetch_data", Params: map[string]interface{}{"url": "https://evil.example/"}}
+	if _, err := s.Verify(narrowed, other); !errors.Is(err, ErrCaveatFailed) {
+		t.Fatalf("expected caveat failure, got %v", err)
+	}
+
+	// Dropping a caveat breaks the HMAC chain.
+	tok, _ := Parse(narrowed)
+	tok.Caveats = tok.Caveats[:len(tok.Caveats)-1]
+	stripped, _ := tok.Encode()
+	if _, err := s.Verify(stripped, other); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+
+	// Tokens from a different secret do not verify.
+	if _, err := NewService([]byte("other"), nil).Verify(narrowed, fetch); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected invalid signature, got %v", err)
+	}
+}
+
+func TestExpiresAndMaxCalls(t *testing.T) {
+	s := NewService([]byte("secret"), nil)
+	token := mint(t, s)
+	task := vc.Task{Action: "fetch_data"}
+
+	limited, _ := Attenuate(token, "max_calls=2")
+	for i := 0; i < 2; i++ {
+		g, err := s.Verify(limited, task)
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if err := g.Use(); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	// Appending more caveats does not reset the budget.
+	longer, _ := Attenuate(limited, "action=fetch_data")
+	g, err := s.Verify(longer, task)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if err := g.Use(); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected exhausted budget, got %v", err)
+	}
+
+	past, _ := Attenuate(token, "expires<"+time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	if _, err := s.Verify(past, task); !errors.Is(err, ErrCaveatFailed) {
+		t.Fatalf("expected expiry, got %v", err)
+	}
+
+	s.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := s.Verify(token, task); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("token outlived its credential: %v", err)
+	}
+}
+
+func TestParseCaveat(t *testing.T) {
+	for _, bad := range []string{"", "noop", "expires=2025-01-01T00:00:00Z", "max_calls=-1", "url<x", "bad key=1"} {
+		if _, err := ParseCaveat(bad); err == nil {
+			t.Errorf("caveat %q accepted", bad)
+		}
+	}
+	c, err := ParseCaveat("url prefix=https://api.internal/")
+	if err != nil || c.Key != "url" || c.Op != opPrefix || c.Value != "https://api.internal/" {
+		t.Fatalf("unexpected caveat %+v, %v", c, err)
+	}
+}
+
+func TestCredentialScope(t *testing.T) {
+	s := NewService([]byte("secret"), nil)
+	cred, _ := holderCredential(t, map[string]interface{}{
+		"role":             "data-fetcher",
+		vc.MetaActions:     []string{"fetch_data"},
+		vc.MetaConstraints: map[string]interface{}{"url": "https://api.internal/"},
+	})
+	token, _, err := s.Mint(cred)
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+
+	if _, err := s.Verify(token, vc.Task{Action: "fetch_data", Params: map[string]interface{}{"url": "https://api.internal/users"}}); err != nil {
+		t.Fatalf("in-scope task rejected: %v", err)
+	}
+	for _, task := range []vc.Task{
+		{Action: "send_notification", Params: map[string]interface{}{"url": "https://api.internal/users"}},
+		{Action: "fetch_data", Params: map[string]interface{}{"url": "https://evil.example/"}},
+	} {
+		var verr *vc.VerificationError
+		if _, err := s.Verify(token, task); !errors.As(err, &verr) || verr.Code != vc.CodeActionDenied {
+			t.Errorf("%+v: expected action_denied, got %v", task, err)
+		}
+	}
+}
+
+func TestHolderBinding(t *testing.T) {
+	s := NewService([]byte("secret"), nil)
+	unbound := vc.NewDelegation("did:example:issuer", "did:example:agent", map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+	if _, _, err := s.Mint(unbound); err == nil {
+		t.Fatal("capability minted from a credential without a holder key")
+	}
+
+	cred, priv := holderCredential(t, map[string]interface{}{"role": "data-fetcher"})
+	token, _, err := s.Mint(cred)
+	if err != nil {
+		t.Fatalf("mint: %v", err)
+	}
+	narrowed, _ := Attenuate(token, "action=fetch_data")
+	g, err := s.Verify(narrowed, vc.Task{Action: "fetch_data"})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	sign := func(key ed25519.PrivateKey) string {
+		return base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte("challenge")))
+	}
+	if err := g.VerifyHolder("challenge", sign(priv)); err != nil {
+		t.Fatalf("holder signature rejected: %v", err)
+	}
+	_, other, _ := ed25519.GenerateKey(nil)
+	for _, sig := range []string{"", sign(other)} {
+		var verr *vc.VerificationError
+		if err := g.VerifyHolder("challenge", sig); !errors.As(err, &verr) || verr.Code != vc.CodeSignatureInvalid {
+			t.Errorf("signature %q: expected signature_invalid, got %v", sig, err)
+		}
+	}
+}
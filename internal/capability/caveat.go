@@ -0,0 +1,99 @@
+package capability
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// Caveat kinds.
+const (
+	opEquals = "="
+	opPrefix = " prefix="
+	opBefore = "<"
+)
+
+// Caveat is a parsed first-party caveat. Supported forms:
+//
+//	action=<action>        the task action must equal <action>
+//	<param>=<value>        task parameter <param> must equal <value>
+//	<param> prefix=<value> task parameter <param> must start with <value>
+//	expires<<RFC 3339>     the token is only valid before that time
+//	max_calls=<n>          the token may be used at most n times
+type Caveat struct {
+	Key   string
+	Op    string
+	Value string
+}
+
+// ParseCaveat parses a caveat string.
+func ParseCaveat(s string) (Caveat, error) {
+	var c Caveat
+	if k, v, ok := strings.Cut(s, opPrefix); ok {
+		c = Caveat{Key: k, Op: opPrefix, Value: v}
+	} else if i := strings.IndexAny(s, "=<"); i > 0 {
+		c = Caveat{Key: s[:i], Op: s[i : i+1], Value: s[i+1:]}
+	} else {
+		return Caveat{}, fmt.Errorf("malformed caveat %q", s)
+	}
+	c.Key = strings.TrimSpace(c.Key)
+	c.Value = strings.TrimSpace(c.Value)
+	if c.Key == "" || strings.ContainsAny(c.Key, " \t") {
+		return Caveat{}, fmt.Errorf("malformed caveat %q", s)
+	}
+	switch {
+	case c.Key == "expires":
+		if c.Op != opBefore {
+			return Caveat{}, fmt.Errorf("caveat %q: expires only supports <", s)
+		}
+		if _, err := time.Parse(time.RFC3339, c.Value); err != nil {
+			return Caveat{}, fmt.Errorf("caveat %q: %w", s, err)
+		}
+	case c.Key == "max_calls":
+		if c.Op != opEquals {
+			return Caveat{}, fmt.Errorf("caveat %q: max_calls only supports =", s)
+		}
+		if n, err := strconv.Atoi(c.Value); err != nil || n < 0 {
+			return Caveat{}, fmt.Errorf("caveat %q: max_calls must be a non-negative integer", s)
+		}
+	case c.Op == opBefore:
+		return Caveat{}, fmt.Errorf("caveat %q: < is only supported for expires", s)
+	}
+	return c, nil
+}
+
+// check evaluates every caveat except max_calls against task at now.
+func (c Caveat) check(task vc.Task, now time.Time) error {
+	switch c.Key {
+	case "expires":
+		exp, _ := time.Parse(time.RFC3339, c.Value)
+		if !now.Before(exp) {
+			return &vc.VerificationError{Code: vc.CodeExpired, Detail: "capability expired at " + c.Value, Err: ErrCaveatFailed}
+		}
+		return nil
+	case "max_calls":
+		return nil
+	case "action":
+		if c.Op == opEquals && task.Action == c.Value {
+			return nil
+		}
+		if c.Op == opPrefix && strings.HasPrefix(task.Action, c.Value) {
+			return nil
+		}
+		return fmt.Errorf("%w: action %q not permitted", ErrCaveatFailed, task.Action)
+	}
+	v, ok := task.Params[c.Key].(string)
+	if !ok {
+		return fmt.Errorf("%w: string param %q required", ErrCaveatFailed, c.Key)
+	}
+	if c.Op == opEquals && v == c.Value {
+		return nil
+	}
+	if c.Op == opPrefix && strings.HasPrefix(v, c.Value) {
+		return nil
+	}
+	return fmt.Errorf("%w: param %s=%q not permitted", ErrCaveatFailed, c.Key, v)
+}
@@ -0,0 +1,215 @@
+package capability
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"github.com/google/uuid"
+)
+
+// ErrExhausted is returned when a max_calls caveat's budget is used up.
+var ErrExhausted = vc.NewError(vc.CodeCallLimitExceeded, "capability call limit reached")
+
+// Identifier is the broker-minted part of a token. It names the agent and
+// role the capability was derived from and carries the source credential's
+// status entries so that revoking the agent also revokes its capabilities,
+// and its holder key so that the token is not a bearer token.
+type Identifier struct {
+	ID       string           `json:"jti"`
+	Subject  string           `json:"sub"`
+	Role     string           `json:"role"`
+	IssuedAt int64            `json:"iat"`
+	Status   []vc.StatusEntry `json:"status,omitempty"`
+	// Scope holds the source credential's actions and constraints metadata,
+	// which every task must satisfy as it would with the credential.
+	Scope map[string]interface{} `json:"scope,omitempty"`
+	// Holder is the source credential's cnf key. Every use of the token
+	// must be signed with it (see Grant.VerifyHolder).
+	Holder *vc.JWK `json:"cnf"`
+}
+
+// Service mints and verifies capability tokens. Root keys are derived from
+// Secret and the token identifier, so no per-token state is stored.
+type Service struct {
+	Secret []byte
+	// Statuses is consulted for the identifier's status entries when set.
+	Statuses vc.StatusLookup
+	Now      vc.Clock
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// NewService returns a Service using secret for root key derivation.
+func NewService(secret []byte, statuses vc.StatusLookup) *Service {
+	return &Service{Secret: secret, Statuses: statuses, calls: map[string]int{}}
+}
+
+// Mint issues a capability for the subject and role of a verified,
+// broker-issued credential. The token expires with the credential and is
+// limited to its actions and constraints.
+func (s *Service) Mint(cred *vc.Credential) (string, time.Time, error) {
+	if cred.ParentCredential != nil {
+		return "", time.Time{}, fmt.Errorf("capabilities are minted from broker-issued credentials; attenuate the capability instead")
+	}
+	if cred.Cnf == nil || cred.Cnf.JWK == nil {
+		return "", time.Time{}, fmt.Errorf("capabilities are minted from credentials bound to a holder key")
+	}
+	role, _ := cred.CredentialSubject.Metadata["role"].(string)
+	exp, err := vc.Expiry(cred)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	scope := map[string]interface{}{}
+	for _, k := range []string{vc.MetaActions, vc.MetaConstraints} {
+		if v, ok := cred.CredentialSubject.Metadata[k]; ok {
+			scope[k] = v
+		}
+	}
+	b, err := json.Marshal(Identifier{
+		ID:       uuid.NewString(),
+		Subject:  cred.CredentialSubject.ID,
+		Role:     role,
+		IssuedAt: s.now().Unix(),
+		Status:   cred.CredentialStatus,
+		Scope:    scope,
+		Holder:   cred.Cnf.JWK,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+	t := newToken(s.rootKey(id), id)
+	encoded, err := t.Encode()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	exp = exp.UTC()
+	encoded, err = Attenuate(encoded, "expires<"+exp.Format(time.RFC3339))
+	return encoded, exp, err
+}
+
+// Verify checks the token's HMAC chain, status, scope and every caveat
+// against task. Call Use on the returned Grant once the task is authorized to
+// consume the token's max_calls budgets.
+func (s *Service) Verify(token string, task vc.Task) (*Grant, error) {
+	t, err := Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	sigs, err := t.signatures(s.rootKey(t.ID))
+	if err != nil {
+		return nil, err
+	}
+	idJSON, err := base64.RawURLEncoding.DecodeString(t.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	g := &Grant{svc: s}
+	if err := json.Unmarshal(idJSON, &g.Identifier); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if s.Statuses != nil {
+		if err := vc.CheckStatus(&vc.Credential{CredentialStatus: g.Status}, s.Statuses); err != nil {
+			if !errors.Is(err, vc.ErrRevoked) && !errors.Is(err, vc.ErrSuspended) {
+				err = fmt.Errorf("%w: %v", vc.ErrStatusUnavailable, err)
+			}
+			return g, err
+		}
+	}
+	if err := vc.CheckTask(&vc.Credential{CredentialSubject: vc.CredentialSubject{Metadata: g.Scope}}, task); err != nil {
+		return g, err
+	}
+
+	now := s.now()
+	for i, raw := range t.Caveats {
+		c, err := ParseCaveat(raw)
+		if err != nil {
+			return g, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if err := c.check(task, now); err != nil {
+			return g, err
+		}
+		if c.Key == "max_calls" {
+			n, _ := strconv.Atoi(c.Value)
+			// The signature at the caveat identifies this attenuation,
+			// whatever caveats are appended after it.
+			g.budgets = append(g.budgets, budget{key: hex.EncodeToString(sigs[i]), limit: n})
+		}
+	}
+	return g, nil
+}
+
+// Grant is a verified capability.
+type Grant struct {
+	Identifier
+	svc     *Service
+	budgets []budget
+}
+
+// VerifyHolder checks signature, the holder key's Ed25519 signature over a
+// broker challenge, unpadded base64url. The caller consumes the challenge.
+func (g *Grant) VerifyHolder(challenge, signature string) error {
+	if g.Holder == nil {
+		return fmt.Errorf("%w: capability is not bound to a holder key", ErrInvalid)
+	}
+	if challenge == "" || signature == "" {
+		return vc.NewError(vc.CodeSignatureInvalid, "capability use requires a challenge signed with the holder key")
+	}
+	return g.Holder.VerifyPossession(challenge, signature)
+}
+
+// Use consumes one call from each of the token's max_calls budgets, or
+// returns ErrExhausted without consuming any.
+func (g *Grant) Use() error {
+	return g.svc.take(g.budgets)
+}
+
+type budget struct {
+	key   string
+	limit int
+}
+
+// take consumes one call from every budget, or none if any is exhausted.
+// Counters are held in memory and reset when the broker restarts.
+func (s *Service) take(budgets []budget) error {
+	if len(budgets) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls == nil {
+		s.calls = map[string]int{}
+	}
+	for _, b := range budgets {
+		if s.calls[b.key] >= b.limit {
+			return ErrExhausted
+		}
+	}
+	for _, b := range budgets {
+		s.calls[b.key]++
+	}
+	return nil
+}
+
+func (s *Service) rootKey(id string) []byte {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte("capability-root-key:" + id))
+	return mac.Sum(nil)
+}
+
+func (s *Service) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,103 @@
+// Package capability implements macaroon-style capability tokens. A token
+// carries an identifier minted by the broker and a list of caveats; its
+// signature is an HMAC chain starting from a root key only the broker can
+// derive. Anyone holding a token can append a caveat, which narrows what the
+// token allows, but nobody can remove one without invalidating the chain.
+package capability
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// Verification failures. Both are *vc.VerificationError values, so they
+// carry the same stable codes as credential failures.
+var (
+	// ErrInvalid is returned for malformed tokens and tokens whose HMAC chain
+	// does not verify.
+	ErrInvalid = vc.NewError(vc.CodeSignatureInvalid, "invalid capability")
+	// ErrCaveatFailed is returned when a caveat does not hold for a task.
+	ErrCaveatFailed = vc.NewError(vc.CodeActionDenied, "capability caveat not satisfied")
+)
+
+// Token is a decoded capability token.
+type Token struct {
+	// ID is the broker-minted identifier (base64url JSON Identifier).
+	ID      string   `json:"id"`
+	Caveats []string `json:"caveats,omitempty"`
+	// Signature is the last link of the HMAC chain.
+	Signature []byte `json:"sig"`
+}
+
+// Parse decodes the base64url token encoding.
+func Parse(s string) (*Token, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	var t Token
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if t.ID == "" || len(t.Signature) != sha256.Size {
+		return nil, ErrInvalid
+	}
+	return &t, nil
+}
+
+// Encode returns the base64url token encoding.
+func (t *Token) Encode() (string, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Attenuate appends caveats to an encoded token. It needs no key and can be
+// done offline by any holder.
+func Attenuate(token string, caveats ...string) (string, error) {
+	t, err := Parse(token)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range caveats {
+		if _, err := ParseCaveat(c); err != nil {
+			return "", err
+		}
+		t.Signature = chain(t.Signature, c)
+		t.Caveats = append(t.Caveats, c)
+	}
+	return t.Encode()
+}
+
+// newToken signs id with rootKey.
+func newToken(rootKey []byte, id string) *Token {
+	return &Token{ID: id, Signature: chain(rootKey, id)}
+}
+
+// signatures recomputes the chain from rootKey and returns the signature
+// after each caveat, checking the final one against t.Signature.
+func (t *Token) signatures(rootKey []byte) ([][]byte, error) {
+	sig := chain(rootKey, t.ID)
+	sigs := make([][]byte, len(t.Caveats))
+	for i, c := range t.Caveats {
+		sig = chain(sig, c)
+		sigs[i] = sig
+	}
+	if !hmac.Equal(sig, t.Signature) {
+		return nil, ErrInvalid
+	}
+	return sigs, nil
+}
+
+func chain(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
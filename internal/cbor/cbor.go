@@ -0,0 +1,470 @@
+// Package cbor implements the subset of RFC 8949 CBOR the broker needs to
+// carry credentials and COSE structures: definite-length items only, text or
+// integer map keys, and the JSON data model plus byte strings and tags.
+//
+// Encoding is deterministic: integers and lengths use their shortest form,
+// floats are written as single precision when that is exact, and map keys
+// are sorted by their encoded bytes.
+package cbor
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Major types.
+const (
+	majorUint   = 0
+	majorNegint = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// maxDepth bounds nesting when decoding untrusted input.
+const maxDepth = 64
+
+// Tag is a tagged data item.
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// Marshal encodes v. Supported values are nil, bool, string, []byte, the
+// integer types, float64, json.Number, []interface{},
+// map[string]interface{}, map[int64]interface{} and Tag. Any other value is
+// converted through its encoding/json form first.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FromJSON converts a JSON document to CBOR.
+func FromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return Marshal(v)
+}
+
+func encode(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case string:
+		writeHead(buf, majorText, uint64(len(v)))
+		buf.WriteString(v)
+	case []byte:
+		writeHead(buf, majorBytes, uint64(len(v)))
+		buf.Write(v)
+	case int:
+		writeInt(buf, int64(v))
+	case int64:
+		writeInt(buf, v)
+	case uint64:
+		writeHead(buf, majorUint, v)
+	case float64:
+		writeFloat(buf, v)
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			writeInt(buf, i)
+			return nil
+		}
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return fmt.Errorf("cbor: invalid number %q", v)
+		}
+		writeFloat(buf, f)
+	case []interface{}:
+		writeHead(buf, majorArray, uint64(len(v)))
+		for _, e := range v {
+			if err := encode(buf, e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]interface{}, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		return writeMap(buf, keys, func(k interface{}) interface{} { return v[k.(string)] })
+	case map[int64]interface{}:
+		keys := make([]interface{}, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		return writeMap(buf, keys, func(k interface{}) interface{} { return v[k.(int64)] })
+	case Tag:
+		writeHead(buf, majorTag, v.Number)
+		return encode(buf, v.Content)
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var generic interface{}
+		if err := dec.Decode(&generic); err != nil {
+			return err
+		}
+		return encode(buf, generic)
+	}
+	return nil
+}
+
+// writeMap writes the entries of a map in encoded-key order.
+func writeMap(buf *bytes.Buffer, keys []interface{}, value func(interface{}) interface{}) error {
+	type entry struct {
+		key []byte
+		src interface{}
+	}
+	entries := make([]entry, len(keys))
+	for i, k := range keys {
+		enc, err := Marshal(k)
+		if err != nil {
+			return err
+		}
+		entries[i] = entry{enc, k}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+	writeHead(buf, majorMap, uint64(len(entries)))
+	for _, e := range entries {
+		buf.Write(e.key)
+		if err := encode(buf, value(e.src)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		buf.WriteByte(m | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{m | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(m | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(n)))
+	case n <= math.MaxUint32:
+		buf.WriteByte(m | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(n)))
+	default:
+		buf.WriteByte(m | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, n))
+	}
+}
+
+func writeInt(buf *bytes.Buffer, i int64) {
+	if i >= 0 {
+		writeHead(buf, majorUint, uint64(i))
+		return
+	}
+	writeHead(buf, majorNegint, uint64(-(i + 1)))
+}
+
+func writeFloat(buf *bytes.Buffer, f float64) {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		writeInt(buf, int64(f))
+		return
+	}
+	if float64(float32(f)) == f || math.IsNaN(f) {
+		buf.WriteByte(0xfa)
+		buf.Write(binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(f))))
+		return
+	}
+	buf.WriteByte(0xfb)
+	buf.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(f)))
+}
+
+// Unmarshal decodes a single data item. Maps with text keys decode to
+// map[string]interface{}, maps with integer keys to map[int64]interface{};
+// integers decode to int64 (or uint64 above math.MaxInt64), floats to
+// float64, byte strings to []byte and tags to Tag.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(d.data) {
+		return nil, fmt.Errorf("cbor: trailing data after item")
+	}
+	return v, nil
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) head() (major byte, n uint64, err error) {
+	if d.off >= len(d.data) {
+		return 0, 0, fmt.Errorf("cbor: unexpected end of data")
+	}
+	b := d.data[d.off]
+	d.off++
+	major, info := b>>5, b&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(d.data)-d.off < size {
+			return 0, 0, fmt.Errorf("cbor: unexpected end of data")
+		}
+		for _, c := range d.data[d.off : d.off+size] {
+			n = n<<8 | uint64(c)
+		}
+		d.off += size
+		return major, n, nil
+	case info == 31:
+		return 0, 0, fmt.Errorf("cbor: indefinite-length items are not supported")
+	default:
+		return 0, 0, fmt.Errorf("cbor: reserved additional information %d", info)
+	}
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("cbor: nesting too deep")
+	}
+	if d.off < len(d.data) {
+		if b := d.data[d.off]; b >= 0xf9 && b <= 0xfb {
+			return d.float()
+		}
+	}
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case majorNegint:
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("cbor: negative integer out of range")
+		}
+		return -int64(n) - 1, nil
+	case majorBytes, majorText:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, fmt.Errorf("cbor: unexpected end of data")
+		}
+		b := d.data[d.off : d.off+int(n)]
+		d.off += int(n)
+		if major == majorText {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case majorArray:
+		if n > uint64(len(d.data)-d.off) {
+			return nil, fmt.Errorf("cbor: array length exceeds data")
+		}
+		arr := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case majorMap:
+		return d.mapValue(n, depth)
+	case majorTag:
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{Number: n, Content: v}, nil
+	default:
+		return simple(n)
+	}
+}
+
+func (d *decoder) mapValue(n uint64, depth int) (interface{}, error) {
+	if n > uint64(len(d.data)-d.off)/2 {
+		return nil, fmt.Errorf("cbor: map length exceeds data")
+	}
+	var (
+		text map[string]interface{}
+		ints map[int64]interface{}
+	)
+	for i := uint64(0); i < n; i++ {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		switch k := k.(type) {
+		case string:
+			if ints != nil {
+				return nil, fmt.Errorf("cbor: mixed map key types")
+			}
+			if text == nil {
+				text = make(map[string]interface{}, n)
+			}
+			if _, dup := text[k]; dup {
+				return nil, fmt.Errorf("cbor: duplicate map key %q", k)
+			}
+			text[k] = v
+		case int64:
+			if text != nil {
+				return nil, fmt.Errorf("cbor: mixed map key types")
+			}
+			if ints == nil {
+				ints = make(map[int64]interface{}, n)
+			}
+			if _, dup := ints[k]; dup {
+				return nil, fmt.Errorf("cbor: duplicate map key %d", k)
+			}
+			ints[k] = v
+		default:
+			return nil, fmt.Errorf("cbor: unsupported map key type %T", k)
+		}
+	}
+	if ints != nil {
+		return ints, nil
+	}
+	if text == nil {
+		text = map[string]interface{}{}
+	}
+	return text, nil
+}
+
+// float decodes a half, single or double precision float.
+func (d *decoder) float() (interface{}, error) {
+	size := 1 << (d.data[d.off] - 0xf8)
+	d.off++
+	if len(d.data)-d.off < size {
+		return nil, fmt.Errorf("cbor: unexpected end of data")
+	}
+	b := d.data[d.off : d.off+size]
+	d.off += size
+	switch size {
+	case 2:
+		return halfToFloat(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	default:
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	}
+}
+
+// simple decodes the remaining major type 7 values.
+func simple(n uint64) (interface{}, error) {
+	switch n {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", n)
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 31:
+		if frac == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// ToJSON converts a CBOR data item to JSON. Byte strings become unpadded
+// base64url text and tags are replaced by their content. Maps with integer
+// keys have no JSON form and are rejected.
+func ToJSON(data []byte) ([]byte, error) {
+	v, err := Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	v, err = jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case []byte:
+		return base64.RawURLEncoding.EncodeToString(v), nil
+	case Tag:
+		return jsonValue(v.Content)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("cbor: %v has no JSON form", v)
+		}
+		return v, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			c, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = c
+		}
+		return out, nil
+	case map[int64]interface{}:
+		return nil, fmt.Errorf("cbor: integer map keys have no JSON form")
+	}
+	return v, nil
+}
@@ -0,0 +1,113 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// Vectors from RFC 8949 Appendix A.
+func TestMarshalVectors(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{int64(1000000000000), "1b000000e8d4a51000"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{1.5, "fa3fc00000"},
+		{1.1, "fb3ff199999999999a"},
+		{false, "f4"},
+		{nil, "f6"},
+		{"IETF", "6449455446"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{[]interface{}{1, []interface{}{2, 3}}, "8201820203"},
+		{map[string]interface{}{"b": []interface{}{2, 3}, "a": 1}, "a26161016162820203"},
+		{map[int64]interface{}{2: 3, 1: 2}, "a201020203"},
+		{Tag{Number: 1, Content: 1363896240}, "c11a514b67b0"},
+	}
+	for _, tc := range tests {
+		got, err := Marshal(tc.in)
+		if err != nil {
+			t.Fatalf("Marshal(%v): %v", tc.in, err)
+		}
+		if hex.EncodeToString(got) != tc.want {
+			t.Errorf("Marshal(%v) = %x, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"1903e8", int64(1000)},
+		{"3903e7", int64(-1000)},
+		{"f93e00", 1.5},
+		{"fa47c35000", 100000.0},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"a26161016162820203", map[string]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+		{"a201020203", map[int64]interface{}{1: int64(2), 2: int64(3)}},
+		{"d8184100", Tag{Number: 24, Content: []byte{0}}},
+	}
+	for _, tc := range tests {
+		data, _ := hex.DecodeString(tc.in)
+		got, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("Unmarshal(%s): %v", tc.in, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Unmarshal(%s) = %#v, want %#v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestUnmarshalRejects(t *testing.T) {
+	for _, in := range []string{
+		"5f42010243030405ff", // indefinite-length byte string
+		"1a0102",             // truncated argument
+		"9a7fffffff",         // array longer than the data
+		"a2616101616102",     // duplicate key
+		"a2016161616102",     // mixed key types
+		"0000",               // trailing data
+	} {
+		data, _ := hex.DecodeString(in)
+		if _, err := Unmarshal(data); err == nil {
+			t.Errorf("Unmarshal(%s) accepted", in)
+		}
+	}
+	deep := bytes.Repeat([]byte{0x81}, maxDepth+2)
+	if _, err := Unmarshal(append(deep, 0)); err == nil {
+		t.Error("deep nesting accepted")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	doc := `{"b":[1,2.5,"x",null,true],"a":{"n":-3,"s":"é"}}`
+	data, err := FromJSON([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ToJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got interface{}
+	json.Unmarshal([]byte(doc), &want)
+	json.Unmarshal(back, &got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip = %s", back)
+	}
+
+	bin, _ := Marshal(map[string]interface{}{"k": []byte{0xfb, 0xff}})
+	if out, _ := ToJSON(bin); string(out) != `{"k":"-_8"}` {
+		t.Errorf("byte string as JSON = %s", out)
+	}
+}
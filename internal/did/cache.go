@@ -0,0 +1,80 @@
+package did
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the cache; expired entries are dropped first.
+const maxCacheEntries = 1024
+
+// Cache is a Resolver that keeps resolved documents for TTL, and DIDs that
+// are invalid, unsupported or not found for NegativeTTL. Other failures,
+// such as an unreachable host, are not cached.
+type Cache struct {
+	Resolver    Resolver
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	doc     *Document
+	err     error
+	expires time.Time
+}
+
+// NewCache wraps r with a cache.
+func NewCache(r Resolver, ttl, negativeTTL time.Duration) *Cache {
+	return &Cache{Resolver: r, TTL: ttl, NegativeTTL: negativeTTL, now: time.Now, entries: map[string]cacheEntry{}}
+}
+
+// Resolve implements Resolver.
+func (c *Cache) Resolve(ctx context.Context, id string) (*Document, error) {
+	now := c.now()
+	c.mu.Lock()
+	e, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.doc, e.err
+	}
+
+	doc, err := c.Resolver.Resolve(ctx, id)
+	ttl := c.TTL
+	if err != nil {
+		if !errors.Is(err, ErrInvalidDID) && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrMethodNotSupported) {
+			return nil, err
+		}
+		ttl = c.NegativeTTL
+	}
+	if ttl > 0 {
+		c.mu.Lock()
+		c.evict(now)
+		c.entries[id] = cacheEntry{doc: doc, err: err, expires: now.Add(ttl)}
+		c.mu.Unlock()
+	}
+	return doc, err
+}
+
+// evict makes room for one entry and must be called with c.mu held.
+func (c *Cache) evict(now time.Time) {
+	if len(c.entries) < maxCacheEntries {
+		return
+	}
+	for id, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, id)
+		}
+	}
+	for id := range c.entries {
+		if len(c.entries) < maxCacheEntries {
+			return
+		}
+		delete(c.entries, id)
+	}
+}
@@ -0,0 +1,103 @@
+package did
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DID document contexts.
+const (
+	ContextDIDv1    = "https://www.w3.org/ns/did/v1"
+	ContextMultikey = "https://w3id.org/security/multikey/v1"
+)
+
+// Document is a DID document.
+type Document struct {
+	Context              []string             `json:"@context"`
+	ID                   string               `json:"id"`
+	VerificationMethod   []VerificationMethod `json:"verificationMethod"`
+	Authentication       []string             `json:"authentication,omitempty"`
+	AssertionMethod      []string             `json:"assertionMethod,omitempty"`
+	CapabilityDelegation []string             `json:"capabilityDelegation,omitempty"`
+	CapabilityInvocation []string             `json:"capabilityInvocation,omitempty"`
+	KeyAgreement         []string             `json:"keyAgreement,omitempty"`
+	Service              []Service            `json:"service,omitempty"`
+}
+
+// Service is a service endpoint of a DID subject.
+type Service struct {
+	ID              string      `json:"id"`
+	Type            string      `json:"type"`
+	ServiceEndpoint interface{} `json:"serviceEndpoint"`
+}
+
+// VerificationMethod is a Multikey or JsonWebKey2020 verification method.
+type VerificationMethod struct {
+	ID                 string          `json:"id"`
+	Type               string          `json:"type"`
+	Controller         string          `json:"controller"`
+	PublicKeyMultibase string          `json:"publicKeyMultibase,omitempty"`
+	PublicKeyJwk       json.RawMessage `json:"publicKeyJwk,omitempty"`
+}
+
+// PublicKey returns the method's public key, as DecodeMultikey or ParseJWK
+// returns it.
+func (vm VerificationMethod) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case vm.PublicKeyMultibase != "":
+		return DecodeMultikey(vm.PublicKeyMultibase)
+	case len(vm.PublicKeyJwk) > 0:
+		return ParseJWK(vm.PublicKeyJwk)
+	default:
+		return nil, fmt.Errorf("verification method %s has no public key", vm.ID)
+	}
+}
+
+// Clone returns a copy of d that shares no slices with it.
+func (d *Document) Clone() *Document {
+	c := *d
+	c.Context = slices.Clone(d.Context)
+	c.VerificationMethod = slices.Clone(d.VerificationMethod)
+	c.Authentication = slices.Clone(d.Authentication)
+	c.AssertionMethod = slices.Clone(d.AssertionMethod)
+	c.CapabilityDelegation = slices.Clone(d.CapabilityDelegation)
+	c.CapabilityInvocation = slices.Clone(d.CapabilityInvocation)
+	c.KeyAgreement = slices.Clone(d.KeyAgreement)
+	c.Service = slices.Clone(d.Service)
+	return &c
+}
+
+// HasRelationship reports whether the verification method id is listed
+// under the verification relationship, such as "assertionMethod".
+func (d *Document) HasRelationship(relationship, id string) bool {
+	var ids []string
+	switch relationship {
+	case "authentication":
+		ids = d.Authentication
+	case "assertionMethod":
+		ids = d.AssertionMethod
+	case "capabilityDelegation":
+		ids = d.CapabilityDelegation
+	case "capabilityInvocation":
+		ids = d.CapabilityInvocation
+	case "keyAgreement":
+		ids = d.KeyAgreement
+	}
+	return slices.ContainsFunc(ids, func(ref string) bool {
+		return ref == id || (strings.HasPrefix(ref, "#") && d.ID+ref == id)
+	})
+}
+
+// Method returns the verification method with the given ID. Method IDs
+// written relative to the document ("#key-1") match their absolute form.
+func (d *Document) Method(id string) (VerificationMethod, bool) {
+	for _, vm := range d.VerificationMethod {
+		if vm.ID == id || (strings.HasPrefix(vm.ID, "#") && d.ID+vm.ID == id) {
+			return vm, true
+		}
+	}
+	return VerificationMethod{}, false
+}
@@ -0,0 +1,97 @@
+package did
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// JWKPrefix starts every did:jwk identifier.
+const JWKPrefix = "did:jwk:"
+
+// ContextJWS2020 is the context of JsonWebKey2020 verification methods.
+const ContextJWS2020 = "https://w3id.org/security/suites/jws-2020/v1"
+
+// publicJWK holds the public members of an OKP or EC JSON Web Key.
+type publicJWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y,omitempty"`
+}
+
+// ResolveJWK expands a did:jwk identifier into its DID document. The single
+// verification method, id did#0, carries the JWK itself.
+func ResolveJWK(id string) (*Document, error) {
+	enc, ok := strings.CutPrefix(id, JWKPrefix)
+	if !ok {
+		return nil, fmt.Errorf("not a did:jwk: %s", id)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid did:jwk encoding: %w", err)
+	}
+	if _, err := ParseJWK(raw); err != nil {
+		return nil, err
+	}
+	vmID := id + "#0"
+	refs := []string{vmID}
+	return &Document{
+		Context: []string{ContextDIDv1, ContextJWS2020},
+		ID:      id,
+		VerificationMethod: []VerificationMethod{{
+			ID:           vmID,
+			Type:         "JsonWebKey2020",
+			Controller:   id,
+			PublicKeyJwk: raw,
+		}},
+		Authentication:       refs,
+		AssertionMethod:      refs,
+		CapabilityDelegation: refs,
+		CapabilityInvocation: refs,
+	}, nil
+}
+
+// ParseJWK parses an Ed25519 or P-256 public JWK. Keys with private members
+// are rejected.
+func ParseJWK(raw []byte) (crypto.PublicKey, error) {
+	var private struct {
+		D string `json:"d"`
+	}
+	var k publicJWK
+	if err := json.Unmarshal(raw, &k); err != nil {
+		return nil, fmt.Errorf("invalid jwk: %w", err)
+	}
+	if json.Unmarshal(raw, &private); private.D != "" {
+		return nil, fmt.Errorf("jwk contains private key material")
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwk x: %w", err)
+	}
+	switch {
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key length %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid p-256 jwk coordinates")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("p-256 jwk point is not on the curve")
+		}
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported jwk %s/%s", k.Kty, k.Crv)
+	}
+}
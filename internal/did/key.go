@@ -0,0 +1,125 @@
+package did
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"fmt"
+	"strings"
+
+	"github.com/bradtumy/agent-identity-poc/internal/multibase"
+)
+
+// KeyPrefix starts every did:key identifier.
+const KeyPrefix = "did:key:"
+
+// Multicodec varint prefixes of the supported public key types.
+var (
+	codecEd25519 = []byte{0xed, 0x01}
+	codecX25519  = []byte{0xec, 0x01}
+	codecP256    = []byte{0x80, 0x24}
+)
+
+// NewKey returns the did:key identifier of an ed25519.PublicKey or a P-256
+// *ecdsa.PublicKey.
+func NewKey(pub crypto.PublicKey) (string, error) {
+	mb, err := EncodeMultikey(pub)
+	if err != nil {
+		return "", err
+	}
+	return KeyPrefix + mb, nil
+}
+
+// EncodeMultikey returns the base58btc publicKeyMultibase form of an
+// ed25519.PublicKey, a P-256 *ecdsa.PublicKey or an X25519 *ecdh.PublicKey.
+// P-256 keys are point-compressed.
+func EncodeMultikey(pub crypto.PublicKey) (string, error) {
+	var raw []byte
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		if len(k) != ed25519.PublicKeySize {
+			return "", fmt.Errorf("invalid ed25519 key length %d", len(k))
+		}
+		raw = append(append(raw, codecEd25519...), k...)
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", fmt.Errorf("unsupported ecdsa curve %s", k.Curve.Params().Name)
+		}
+		raw = append(append(raw, codecP256...), elliptic.MarshalCompressed(k.Curve, k.X, k.Y)...)
+	case *ecdh.PublicKey:
+		if k.Curve() != ecdh.X25519() {
+			return "", fmt.Errorf("unsupported ecdh curve %s", k.Curve())
+		}
+		raw = append(append(raw, codecX25519...), k.Bytes()...)
+	default:
+		return "", fmt.Errorf("unsupported key type %T", pub)
+	}
+	return multibase.Encode(multibase.Base58BTC, raw)
+}
+
+// DecodeMultikey parses a publicKeyMultibase value into an
+// ed25519.PublicKey, a P-256 *ecdsa.PublicKey or an X25519 *ecdh.PublicKey.
+func DecodeMultikey(mb string) (crypto.PublicKey, error) {
+	if !strings.HasPrefix(mb, string(multibase.Base58BTC)) {
+		return nil, fmt.Errorf("multikey must be base58btc encoded")
+	}
+	raw, err := multibase.Decode(mb)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(raw, codecEd25519):
+		key := raw[len(codecEd25519):]
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key length %d", len(key))
+		}
+		return ed25519.PublicKey(key), nil
+	case bytes.HasPrefix(raw, codecP256):
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), raw[len(codecP256):])
+		if x == nil {
+			return nil, fmt.Errorf("invalid compressed p-256 point")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case bytes.HasPrefix(raw, codecX25519):
+		return ecdh.X25519().NewPublicKey(raw[len(codecX25519):])
+	default:
+		return nil, fmt.Errorf("unsupported multicodec key type")
+	}
+}
+
+// ParseKey returns the public key encoded in a did:key identifier.
+func ParseKey(id string) (crypto.PublicKey, error) {
+	if !strings.HasPrefix(id, KeyPrefix) {
+		return nil, fmt.Errorf("not a did:key: %s", id)
+	}
+	return DecodeMultikey(strings.TrimPrefix(id, KeyPrefix))
+}
+
+// ResolveKey expands a did:key identifier into its DID document. The single
+// verification method, id did#<multibase>, is referenced from every
+// verification relationship.
+func ResolveKey(id string) (*Document, error) {
+	if _, err := ParseKey(id); err != nil {
+		return nil, err
+	}
+	mb := strings.TrimPrefix(id, KeyPrefix)
+	vmID := id + "#" + mb
+	refs := []string{vmID}
+	return &Document{
+		Context: []string{ContextDIDv1, ContextMultikey},
+		ID:      id,
+		VerificationMethod: []VerificationMethod{{
+			ID:                 vmID,
+			Type:               "Multikey",
+			Controller:         id,
+			PublicKeyMultibase: mb,
+		}},
+		Authentication:       refs,
+		AssertionMethod:      refs,
+		CapabilityDelegation: refs,
+		CapabilityInvocation: refs,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package did
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestKeyRoundTrip(t *testing.T) {
+	edPub, _, _ := ed25519.GenerateKey(nil)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tests := []struct {
+		pub    interface{}
+		prefix string
+	}{
+		{edPub, "did:key:z6Mk"},
+		{&ecKey.PublicKey, "did:key:zDn"},
+	}
+	for _, tc := range tests {
+		id, err := NewKey(tc.pub)
+		if err != nil {
+			t.Fatalf("NewKey: %v", err)
+		}
+		if !strings.HasPrefix(id, tc.prefix) {
+			t.Errorf("%s does not start with %s", id, tc.prefix)
+		}
+		pub, err := ParseKey(id)
+		if err != nil {
+			t.Fatalf("ParseKey(%s): %v", id, err)
+		}
+		if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(tc.pub) {
+			t.Errorf("ParseKey(%s) returned a different key", id)
+		}
+	}
+}
+
+// Test vectors from the did:key method specification.
+func TestResolveKey(t *testing.T) {
+	for _, id := range []string{
+		"did:key:z6MkiTBz1ymuepAQ4HEHYSF1H8quG5GLVVQR3djdX3mDooWp",
+		"did:key:zDnaerDaTF5BXEavCrfRZEk316dpbLsfPDZ3WJ5hRTPFU2169",
+	} {
+		doc, err := ResolveKey(id)
+		if err != nil {
+			t.Fatalf("ResolveKey(%s): %v", id, err)
+		}
+		vmID := id + "#" + strings.TrimPrefix(id, KeyPrefix)
+		vm, ok := doc.Method(vmID)
+		if !ok || vm.Type != "Multikey" || vm.Controller != id {
+			t.Fatalf("unexpected document: %+v", doc)
+		}
+		if doc.AssertionMethod[0] != vmID || doc.Authentication[0] != vmID {
+			t.Errorf("relationships do not reference %s", vmID)
+		}
+		pub, _ := ParseKey(id)
+		if again, _ := NewKey(pub); again != id {
+			t.Errorf("re-encoded %s as %s", id, again)
+		}
+	}
+
+	for _, bad := range []string{
+		"did:example:123",
+		"did:key:6MkiTBz1ymuepAQ4HEHYSF1H8quG5GLVVQR3djdX3mDooWp",
+		"did:key:z6MkiTBz1ymuep",
+		"did:key:zQ3shokFTS3brHcDQrn82RUDfCZESWL1ZdCEJwekUDPQiYBme",
+	} {
+		if _, err := ResolveKey(bad); err == nil {
+			t.Errorf("ResolveKey(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestWeb(t *testing.T) {
+	tests := []struct {
+		url, id, doc string
+	}{
+		{"https://example.com", "did:web:example.com", "https://example.com/.well-known/did.json"},
+		{"http://localhost:8081/", "did:web:localhost%3A8081", "https://localhost:8081/.well-known/did.json"},
+		{"https://example.com/user/alice", "did:web:example.com:user:alice", "https://example.com/user/alice/did.json"},
+	}
+	for _, tc := range tests {
+		id, err := WebFromURL(tc.url)
+		if err != nil || id != tc.id {
+			t.Errorf("WebFromURL(%s) = %s, %v; want %s", tc.url, id, err, tc.id)
+		}
+		doc, err := WebDocumentURL(tc.id)
+		if err != nil || doc != tc.doc {
+			t.Errorf("WebDocumentURL(%s) = %s, %v; want %s", tc.id, doc, err, tc.doc)
+		}
+	}
+	for _, bad := range []string{"did:web:", "did:key:z6Mk", "did:web:example.com:a/b"} {
+		if _, err := WebDocumentURL(bad); err == nil {
+			t.Errorf("WebDocumentURL(%s) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package did
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PeerPrefix starts every did:peer identifier.
+const PeerPrefix = "did:peer:"
+
+// Purpose codes of did:peer:2 key elements, naming the verification
+// relationship a key is listed under.
+const (
+	PeerAssertion            byte = 'A'
+	PeerKeyAgreement         byte = 'E'
+	PeerAuthentication       byte = 'V'
+	PeerCapabilityInvocation byte = 'I'
+	PeerCapabilityDelegation byte = 'D'
+	peerService              byte = 'S'
+)
+
+// PeerKey is a key element of a did:peer:2 identifier.
+type PeerKey struct {
+	Purpose byte
+	Key     crypto.PublicKey
+}
+
+// peerAbbreviations shortens service member names in did:peer:2 service
+// elements. The DIDCommMessaging service type is also abbreviated.
+var peerAbbreviations = map[string]string{
+	"type":            "t",
+	"serviceEndpoint": "s",
+	"routingKeys":     "r",
+	"accept":          "a",
+}
+
+const (
+	peerDIDCommType      = "DIDCommMessaging"
+	peerDIDCommTypeShort = "dm"
+)
+
+// NewPeer2 returns a did:peer numalgo 2 identifier listing keys, in order,
+// and services. Services without an ID get the default #service,
+// #service-1, ... on resolution.
+func NewPeer2(keys []PeerKey, services []Service) (string, error) {
+	if len(keys) == 0 {
+		return "", fmt.Errorf("did:peer:2 requires at least one key")
+	}
+	var b strings.Builder
+	b.WriteString(PeerPrefix + "2")
+	for _, k := range keys {
+		if !strings.ContainsRune("AEVID", rune(k.Purpose)) {
+			return "", fmt.Errorf("invalid did:peer:2 purpose %q", k.Purpose)
+		}
+		mb, err := EncodeMultikey(k.Key)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString("." + string(k.Purpose) + mb)
+	}
+	for _, s := range services {
+		if s.Type == peerDIDCommType {
+			s.Type = peerDIDCommTypeShort
+		}
+		raw, err := json.Marshal(s)
+		if err != nil {
+			return "", err
+		}
+		var svc map[string]interface{}
+		json.Unmarshal(raw, &svc)
+		if s.ID == "" {
+			delete(svc, "id")
+		}
+		if raw, err = json.Marshal(abbreviate(svc, peerAbbreviations)); err != nil {
+			return "", err
+		}
+		b.WriteString("." + string(peerService) + base64.RawURLEncoding.EncodeToString(raw))
+	}
+	return b.String(), nil
+}
+
+// ResolvePeer expands a did:peer identifier into its DID document. Numalgo
+// 0, an inception key wrapped like a did:key, and numalgo 2, a list of keys
+// and services, are supported.
+func ResolvePeer(id string) (*Document, error) {
+	rest, ok := strings.CutPrefix(id, PeerPrefix)
+	if !ok || rest == "" {
+		return nil, fmt.Errorf("not a did:peer: %s", id)
+	}
+	switch rest[0] {
+	case '0':
+		return resolvePeer0(id, rest[1:])
+	case '2':
+		return resolvePeer2(id, rest[1:])
+	default:
+		return nil, fmt.Errorf("unsupported did:peer numalgo %c", rest[0])
+	}
+}
+
+// resolvePeer0 resolves the did:key with the same multikey and renames it.
+func resolvePeer0(id, mb string) (*Document, error) {
+	doc, err := ResolveKey(KeyPrefix + mb)
+	if err != nil {
+		return nil, err
+	}
+	vmID := id + "#" + mb
+	refs := []string{vmID}
+	doc.ID = id
+	doc.VerificationMethod[0].ID = vmID
+	doc.VerificationMethod[0].Controller = id
+	doc.Authentication = refs
+	doc.AssertionMethod = refs
+	doc.CapabilityDelegation = refs
+	doc.CapabilityInvocation = refs
+	return doc, nil
+}
+
+// resolvePeer2 numbers keys #key-1, #key-2, ... in order of appearance and
+// lists each under the relationship named by its purpose code.
+func resolvePeer2(id, elements string) (*Document, error) {
+	if !strings.HasPrefix(elements, ".") {
+		return nil, fmt.Errorf("invalid did:peer:2: %s", id)
+	}
+	doc := &Document{
+		Context:            []string{ContextDIDv1, ContextMultikey},
+		ID:                 id,
+		VerificationMethod: []VerificationMethod{},
+	}
+	for _, el := range strings.Split(elements[1:], ".") {
+		if len(el) < 2 {
+			return nil, fmt.Errorf("invalid did:peer:2 element %q", el)
+		}
+		purpose, value := el[0], el[1:]
+		if purpose == peerService {
+			svc, err := decodePeerService(value, len(doc.Service))
+			if err != nil {
+				return nil, err
+			}
+			doc.Service = append(doc.Service, svc)
+			continue
+		}
+		if _, err := DecodeMultikey(value); err != nil {
+			return nil, fmt.Errorf("invalid did:peer:2 key: %w", err)
+		}
+		ref := "#key-" + strconv.Itoa(len(doc.VerificationMethod)+1)
+		doc.VerificationMethod = append(doc.VerificationMethod, VerificationMethod{
+			ID:                 ref,
+			Type:               "Multikey",
+			Controller:         id,
+			PublicKeyMultibase: value,
+		})
+		switch purpose {
+		case PeerAssertion:
+			doc.AssertionMethod = append(doc.AssertionMethod, ref)
+		case PeerKeyAgreement:
+			doc.KeyAgreement = append(doc.KeyAgreement, ref)
+		case PeerAuthentication:
+			doc.Authentication = append(doc.Authentication, ref)
+		case PeerCapabilityInvocation:
+			doc.CapabilityInvocation = append(doc.CapabilityInvocation, ref)
+		case PeerCapabilityDelegation:
+			doc.CapabilityDelegation = append(doc.CapabilityDelegation, ref)
+		default:
+			return nil, fmt.Errorf("invalid did:peer:2 purpose %q", purpose)
+		}
+	}
+	if len(doc.VerificationMethod) == 0 {
+		return nil, fmt.Errorf("did:peer:2 lists no keys: %s", id)
+	}
+	return doc, nil
+}
+
+// decodePeerService expands the n-th (from zero) service element.
+func decodePeerService(value string, n int) (Service, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return Service{}, fmt.Errorf("invalid did:peer:2 service encoding: %w", err)
+	}
+	var abbreviated map[string]interface{}
+	if err := json.Unmarshal(raw, &abbreviated); err != nil {
+		return Service{}, fmt.Errorf("invalid did:peer:2 service: %w", err)
+	}
+	expansions := make(map[string]string, len(peerAbbreviations))
+	for long, short := range peerAbbreviations {
+		expansions[short] = long
+	}
+	m := abbreviate(abbreviated, expansions).(map[string]interface{})
+	svc := Service{ServiceEndpoint: m["serviceEndpoint"]}
+	svc.Type, _ = m["type"].(string)
+	if svc.Type == peerDIDCommTypeShort {
+		svc.Type = peerDIDCommType
+	}
+	svc.ID, _ = m["id"].(string)
+	if svc.ID == "" {
+		svc.ID = "#service"
+		if n > 0 {
+			svc.ID += "-" + strconv.Itoa(n)
+		}
+	}
+	if svc.Type == "" || svc.ServiceEndpoint == nil {
+		return Service{}, fmt.Errorf("did:peer:2 service needs a type and endpoint")
+	}
+	return svc, nil
+}
+
+// abbreviate renames the object members found in table throughout v.
+func abbreviate(v interface{}, table map[string]string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			if short, ok := table[k]; ok {
+				k = short
+			}
+			out[k] = abbreviate(e, table)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = abbreviate(e, table)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,83 @@
+package did
+
+import (
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Example from the did:peer specification.
+const peer2Example = "did:peer:2.Vz6Mkj3PUd1WjvaDhNZhhhXQdz5UnZXmS7ehtx8bsPpD47kKc.Ez6LSg8zQom395jKLrGiBNruB8MA1ZwMEkhx2HU1BT9oCPxUh.SeyJ0IjoiZG0iLCJzIjp7InVyaSI6Imh0dHA6Ly9leGFtcGxlLmNvbS9kaWRjb21tIiwiYSI6WyJkaWRjb21tL3YyIl0sInIiOlsiZGlkOmV4YW1wbGU6MTIzNDU2Nzg5YWJjZGVmZ2hpI2tleS0xIl19fQ"
+
+func TestResolvePeer2Example(t *testing.T) {
+	doc, err := ResolvePeer(peer2Example)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(doc.VerificationMethod) != 2 || doc.VerificationMethod[0].ID != "#key-1" || doc.VerificationMethod[1].ID != "#key-2" {
+		t.Fatalf("unexpected methods: %+v", doc.VerificationMethod)
+	}
+	if !reflect.DeepEqual(doc.Authentication, []string{"#key-1"}) || !reflect.DeepEqual(doc.KeyAgreement, []string{"#key-2"}) {
+		t.Fatalf("relationships: authentication %v, keyAgreement %v", doc.Authentication, doc.KeyAgreement)
+	}
+	if _, err := doc.VerificationMethod[1].PublicKey(); err != nil {
+		t.Fatalf("x25519 key: %v", err)
+	}
+	want := Service{
+		ID:   "#service",
+		Type: "DIDCommMessaging",
+		ServiceEndpoint: map[string]interface{}{
+			"uri":         "http://example.com/didcomm",
+			"accept":      []interface{}{"didcomm/v2"},
+			"routingKeys": []interface{}{"did:example:123456789abcdefghi#key-1"},
+		},
+	}
+	if len(doc.Service) != 1 || !reflect.DeepEqual(doc.Service[0], want) {
+		t.Fatalf("service = %+v", doc.Service)
+	}
+}
+
+func TestNewPeer2(t *testing.T) {
+	auth, _, _ := ed25519.GenerateKey(nil)
+	agreement, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	services := []Service{
+		{Type: "DIDCommMessaging", ServiceEndpoint: map[string]interface{}{"uri": "https://agent.example/didcomm", "accept": []string{"didcomm/v2"}}},
+		{ID: "#api", Type: "AgentAPI", ServiceEndpoint: "https://agent.example/api"},
+	}
+	id, err := NewPeer2([]PeerKey{
+		{Purpose: PeerAuthentication, Key: auth},
+		{Purpose: PeerKeyAgreement, Key: agreement.PublicKey()},
+	}, services)
+	if err != nil {
+		t.Fatalf("NewPeer2: %v", err)
+	}
+	if !strings.HasPrefix(id, "did:peer:2.Vz6Mk") {
+		t.Fatalf("unexpected identifier %s", id)
+	}
+	doc, err := ResolvePeer(id)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	vm, ok := doc.Method(id + doc.Authentication[0])
+	if !ok {
+		t.Fatal("authentication key not found by absolute id")
+	}
+	if pub, _ := vm.PublicKey(); !auth.Equal(pub) {
+		t.Fatal("authentication key mismatch")
+	}
+	if len(doc.Service) != 2 || doc.Service[0].ID != "#service" || doc.Service[0].Type != "DIDCommMessaging" || doc.Service[1].ID != "#api" {
+		t.Fatalf("services = %+v", doc.Service)
+	}
+
+	if _, err := NewPeer2([]PeerKey{{Purpose: 'X', Key: auth}}, nil); err == nil {
+		t.Fatal("invalid purpose accepted")
+	}
+	for _, bad := range []string{"did:peer:2", "did:peer:2.Xz6Mk", "did:peer:2.Sabc", "did:peer:2.Vz6Mkbogus", "did:peer:3abc"} {
+		if _, err := ResolvePeer(bad); err == nil {
+			t.Errorf("ResolvePeer(%s) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package did
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Resolution errors. Drivers wrap them so callers and Cache can tell a DID
+// that does not resolve from a transient failure.
+var (
+	ErrInvalidDID         = errors.New("invalid did")
+	ErrNotFound           = errors.New("did not found")
+	ErrMethodNotSupported = errors.New("did method not supported")
+)
+
+// Resolver resolves a DID to its DID document.
+type Resolver interface {
+	Resolve(ctx context.Context, id string) (*Document, error)
+}
+
+// ResolverFunc adapts a function to Resolver.
+type ResolverFunc func(ctx context.Context, id string) (*Document, error)
+
+// Resolve calls f.
+func (f ResolverFunc) Resolve(ctx context.Context, id string) (*Document, error) {
+	return f(ctx, id)
+}
+
+// Local wraps a resolver that needs no I/O, reporting its errors as
+// ErrInvalidDID.
+func Local(resolve func(id string) (*Document, error)) Resolver {
+	return ResolverFunc(func(_ context.Context, id string) (*Document, error) {
+		doc, err := resolve(id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDID, err)
+		}
+		return doc, nil
+	})
+}
+
+// MethodName returns the method of a DID, "key" for "did:key:...".
+func MethodName(id string) (string, error) {
+	rest, ok := strings.CutPrefix(id, "did:")
+	method, specific, found := strings.Cut(rest, ":")
+	if !ok || !found || method == "" || specific == "" {
+		return "", fmt.Errorf("%w: %s", ErrInvalidDID, id)
+	}
+	return method, nil
+}
+
+// MethodResolver dispatches each DID to the driver registered for its
+// method, or to Fallback for other methods.
+type MethodResolver struct {
+	Drivers  map[string]Resolver
+	Fallback Resolver
+}
+
+// NewResolver returns a MethodResolver with drivers for did:key, did:jwk,
+// did:peer and did:web. did:web documents are fetched with client, or
+// http.DefaultClient when nil.
+func NewResolver(client *http.Client) *MethodResolver {
+	return &MethodResolver{Drivers: map[string]Resolver{
+		"key":  Local(ResolveKey),
+		"jwk":  Local(ResolveJWK),
+		"peer": Local(ResolvePeer),
+		"web":  &WebResolver{Client: client},
+	}}
+}
+
+// Resolve implements Resolver.
+func (m *MethodResolver) Resolve(ctx context.Context, id string) (*Document, error) {
+	method, err := MethodName(id)
+	if err != nil {
+		return nil, err
+	}
+	if driver, ok := m.Drivers[method]; ok {
+		return driver.Resolve(ctx, id)
+	}
+	if m.Fallback != nil {
+		return m.Fallback.Resolve(ctx, id)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrMethodNotSupported, method)
+}
@@ -0,0 +1,188 @@
+package did
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Example from the did:jwk specification.
+const jwkDID = "did:jwk:eyJjcnYiOiJQLTI1NiIsImt0eSI6IkVDIiwieCI6ImFjYklRaXVNczNpOF91c3pFakoydHBUdFJNNEVVM3l6OTFQSDZDZEgyVjAiLCJ5IjoiX0tjeUxqOXZXTXB0bm1LdG00NkdxRHo4d2Y3NEk1TEtncmwyR3pIM25TRSJ9"
+
+func TestResolveLocalMethods(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	keyDID, _ := NewKey(pub)
+	peerDID := "did:peer:0" + strings.TrimPrefix(keyDID, KeyPrefix)
+	r := NewResolver(nil)
+
+	for _, id := range []string{keyDID, peerDID} {
+		doc, err := r.Resolve(context.Background(), id)
+		if err != nil {
+			t.Fatalf("resolve %s: %v", id, err)
+		}
+		vm, ok := doc.Method(doc.AssertionMethod[0])
+		if !ok || vm.Controller != id {
+			t.Fatalf("%s: assertion method not listed", id)
+		}
+		if got, err := vm.PublicKey(); err != nil || !pub.Equal(got) {
+			t.Fatalf("%s: wrong key: %v", id, err)
+		}
+	}
+
+	doc, err := r.Resolve(context.Background(), jwkDID)
+	if err != nil {
+		t.Fatalf("resolve did:jwk: %v", err)
+	}
+	vm, ok := doc.Method(jwkDID + "#0")
+	if !ok {
+		t.Fatal("did:jwk method #0 not found")
+	}
+	if got, err := vm.PublicKey(); err != nil {
+		t.Fatalf("did:jwk key: %v", err)
+	} else if _, ok := got.(*ecdsa.PublicKey); !ok {
+		t.Fatalf("did:jwk key is %T", got)
+	}
+
+	for id, want := range map[string]error{
+		"did:key:zBogus":     ErrInvalidDID,
+		"did:peer:2Ez6Lk":    ErrInvalidDID,
+		"did:example:123":    ErrMethodNotSupported,
+		"not-a-did":          ErrInvalidDID,
+		"did:jwk:eyJrdHkiOn": ErrInvalidDID,
+	} {
+		if _, err := r.Resolve(context.Background(), id); !errors.Is(err, want) {
+			t.Errorf("resolve %s: %v, want %v", id, err, want)
+		}
+	}
+}
+
+func TestWebResolver(t *testing.T) {
+	var doc Document
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/did.json", "/users/alice/did.json":
+			json.NewEncoder(w).Encode(doc)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	base, _ := WebFromURL(srv.URL)
+	r := &WebResolver{Client: srv.Client()}
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	mb, _ := EncodeMultikey(pub)
+	doc = Document{ID: base, VerificationMethod: []VerificationMethod{{ID: "#key-1", Type: "Multikey", Controller: base, PublicKeyMultibase: mb}}}
+	got, err := r.Resolve(context.Background(), base)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if _, ok := got.Method(base + "#key-1"); !ok {
+		t.Fatal("relative method id not matched")
+	}
+
+	// The served document must be the requested DID's.
+	if _, err := r.Resolve(context.Background(), base+":users:alice"); err == nil {
+		t.Fatal("document for another DID accepted")
+	}
+	if _, err := r.Resolve(context.Background(), base+":users:bob"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing document: %v, want ErrNotFound", err)
+	}
+}
+
+func TestHTTPResolver(t *testing.T) {
+	const found, bare = "did:example:found", "did:example:bare"
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/1.0/identifiers/")
+		requests = append(requests, id)
+		switch id {
+		case found:
+			w.Header().Set("Content-Type", resolutionProfile)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"didDocument":           Document{ID: found},
+				"didResolutionMetadata": map[string]string{"contentType": "application/did+ld+json"},
+			})
+		case bare:
+			w.Header().Set("Content-Type", "application/did+ld+json")
+			json.NewEncoder(w).Encode(Document{ID: bare})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"didResolutionMetadata": map[string]string{"error": "notFound"},
+			})
+		}
+	}))
+	defer srv.Close()
+	r := &HTTPResolver{Endpoint: srv.URL + "/"}
+
+	for _, id := range []string{found, bare} {
+		doc, err := r.Resolve(context.Background(), id)
+		if err != nil || doc.ID != id {
+			t.Fatalf("resolve %s: %v, %+v", id, err, doc)
+		}
+	}
+	if _, err := r.Resolve(context.Background(), "did:example:missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing DID: %v, want ErrNotFound", err)
+	}
+	if len(requests) != 3 || requests[0] != found {
+		t.Fatalf("unexpected requests %v", requests)
+	}
+}
+
+func TestCache(t *testing.T) {
+	calls := map[string]int{}
+	fail := errors.New("connection refused")
+	backend := ResolverFunc(func(_ context.Context, id string) (*Document, error) {
+		calls[id]++
+		switch id {
+		case "did:example:ok":
+			return &Document{ID: id}, nil
+		case "did:example:gone":
+			return nil, ErrNotFound
+		}
+		return nil, fail
+	})
+	now := time.Now()
+	c := NewCache(backend, time.Minute, 10*time.Second)
+	c.now = func() time.Time { return now }
+	resolve := func(id string) error {
+		_, err := c.Resolve(context.Background(), id)
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := resolve("did:example:ok"); err != nil {
+			t.Fatalf("resolve: %v", err)
+		}
+		if err := resolve("did:example:gone"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("negative entry: %v", err)
+		}
+		resolve("did:example:down")
+	}
+	if calls["did:example:ok"] != 1 || calls["did:example:gone"] != 1 {
+		t.Fatalf("results not cached: %v", calls)
+	}
+	if calls["did:example:down"] != 3 {
+		t.Fatalf("transient failure cached: %v", calls)
+	}
+
+	now = now.Add(30 * time.Second)
+	resolve("did:example:ok")
+	resolve("did:example:gone")
+	if calls["did:example:ok"] != 1 || calls["did:example:gone"] != 2 {
+		t.Fatalf("negative TTL not applied: %v", calls)
+	}
+	now = now.Add(time.Minute)
+	resolve("did:example:ok")
+	if calls["did:example:ok"] != 2 {
+		t.Fatalf("expired entry served: %v", calls)
+	}
+}
@@ -0,0 +1,87 @@
+package did
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// resolutionProfile is the media type profile of a DID resolution result.
+const resolutionProfile = `application/ld+json;profile="https://w3id.org/did-resolution"`
+
+// HTTPResolver resolves DIDs with a Universal Resolver-compatible service,
+// GET <Endpoint>/1.0/identifiers/<did>.
+type HTTPResolver struct {
+	Endpoint string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// resolutionResult is the body of a DID resolution response. Services that
+// return the bare DID document leave DIDDocument unset.
+type resolutionResult struct {
+	DIDDocument *Document `json:"didDocument"`
+	Metadata    struct {
+		Error string `json:"error"`
+	} `json:"didResolutionMetadata"`
+}
+
+// Resolve implements Resolver.
+func (r *HTTPResolver) Resolve(ctx context.Context, id string) (*Document, error) {
+	if _, err := MethodName(id); err != nil {
+		return nil, err
+	}
+	endpoint := strings.TrimSuffix(r.Endpoint, "/") + "/1.0/identifiers/" + id
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", resolutionProfile+", application/did+ld+json;q=0.9, application/did+json;q=0.8")
+	resp, err := httpClient(r.Client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var result resolutionResult
+	json.Unmarshal(body, &result)
+	if err := resolutionError(result.Metadata.Error, resp.StatusCode, id); err != nil {
+		return nil, err
+	}
+	doc := result.DIDDocument
+	if doc == nil {
+		doc = new(Document)
+		if err := json.Unmarshal(body, doc); err != nil {
+			return nil, fmt.Errorf("invalid resolution response for %s: %w", id, err)
+		}
+	}
+	if doc.ID != id {
+		return nil, fmt.Errorf("resolver returned a document for %q, not %s", doc.ID, id)
+	}
+	return doc, nil
+}
+
+// resolutionError maps the resolution metadata error, or failing HTTP
+// status, to the package's errors.
+func resolutionError(code string, status int, id string) error {
+	switch {
+	case code == "invalidDid" || status == http.StatusBadRequest:
+		return fmt.Errorf("%w: %s", ErrInvalidDID, id)
+	case code == "notFound" || status == http.StatusNotFound || status == http.StatusGone:
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	case code == "methodNotSupported" || status == http.StatusNotImplemented:
+		return fmt.Errorf("%w: %s", ErrMethodNotSupported, id)
+	case code != "":
+		return fmt.Errorf("resolving %s: %s", id, code)
+	case status != http.StatusOK:
+		return fmt.Errorf("resolving %s: status %d", id, status)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package did
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WebPrefix starts every did:web identifier.
+const WebPrefix = "did:web:"
+
+// WebFromURL derives the did:web identifier of an HTTP(S) base URL. A port
+// is percent-encoded and path segments become colon-separated, so
+// "https://example.com:8443/broker" is "did:web:example.com%3A8443:broker".
+func WebFromURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("did:web requires an http(s) URL with a host: %q", rawURL)
+	}
+	id := WebPrefix + strings.ReplaceAll(u.Host, ":", "%3A")
+	for _, seg := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+		if seg != "" {
+			id += ":" + url.PathEscape(seg)
+		}
+	}
+	return id, nil
+}
+
+// WebDocumentURL returns the HTTPS URL of a did:web identifier's DID
+// document: /.well-known/did.json for a bare host, <path>/did.json otherwise.
+func WebDocumentURL(id string) (string, error) {
+	rest, ok := strings.CutPrefix(id, WebPrefix)
+	if !ok || rest == "" {
+		return "", fmt.Errorf("not a did:web: %s", id)
+	}
+	if strings.ContainsAny(rest, "/?#") {
+		return "", fmt.Errorf("invalid did:web: %s", id)
+	}
+	segs := strings.Split(rest, ":")
+	host, err := url.PathUnescape(segs[0])
+	if err != nil || host == "" {
+		return "", fmt.Errorf("invalid did:web host: %s", id)
+	}
+	path := "/.well-known"
+	if len(segs) > 1 {
+		path = ""
+		for _, seg := range segs[1:] {
+			s, err := url.PathUnescape(seg)
+			if err != nil || s == "" {
+				return "", fmt.Errorf("invalid did:web path: %s", id)
+			}
+			path += "/" + url.PathEscape(s)
+		}
+	}
+	return "https://" + host + path + "/did.json", nil
+}
+
+// maxDocumentSize bounds DID documents fetched over HTTP.
+const maxDocumentSize = 1 << 20
+
+// WebResolver resolves did:web identifiers by fetching their DID document
+// over HTTPS.
+type WebResolver struct {
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Resolve implements Resolver.
+func (r *WebResolver) Resolve(ctx context.Context, id string) (*Document, error) {
+	docURL, err := WebDocumentURL(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDID, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, docURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/did+json, application/json")
+	resp, err := httpClient(r.Client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("fetching %s: status %d", docURL, resp.StatusCode)
+	}
+	var doc Document
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid did document at %s: %w", docURL, err)
+	}
+	if doc.ID != id {
+		return nil, fmt.Errorf("did document at %s is for %s", docURL, doc.ID)
+	}
+	return &doc, nil
+}
+
+func httpClient(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
@@ -0,0 +1,96 @@
+package jcs
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTransformRFC8785Example(t *testing.T) {
+	in := `{
+  "numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+  "string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+  "literals": [null, true, false]
+}`
+	want := `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`
+	got, err := Transform([]byte(in))
+	if err != nil {
+		t.Fatalf("transform: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestTransformSortsByUTF16(t *testing.T) {
+	in := `{"\u20ac":"Euro Sign","\r":"Carriage Return","\ufb33":"Hebrew Letter Dalet With Dagesh","1":"One","\ud83d\ude00":"Emoji: Grinning Face","\u0080":"Control","\u00f6":"Latin Small Letter O With Diaeresis"}`
+	want := "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\",\"\U0001f600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}"
+	got, err := Transform([]byte(in))
+	if err != nil {
+		t.Fatalf("transform: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		bits uint64
+		want string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	}
+	for _, tc := range tests {
+		if got := FormatFloat(math.Float64frombits(tc.bits)); got != tc.want {
+			t.Errorf("%016x: got %s want %s", tc.bits, got, tc.want)
+		}
+	}
+}
+
+func TestTransformEquivalentEncodings(t *testing.T) {
+	variants := []string{
+		`{"token_ttl":3600,"role":"data-fetcher","tags":["a","b"]}`,
+		`{ "role" : "data-fetcher", "tags" : [ "a", "b" ], "token_ttl" : 3600.0 }`,
+		"{\n  \"tags\": [\"\\u0061\", \"b\"],\n  \"token_ttl\": 3.6e3,\n  \"role\": \"data\\u002dfetcher\"\n}",
+	}
+	want := `{"role":"data-fetcher","tags":["a","b"],"token_ttl":3600}`
+	for _, v := range variants {
+		got, err := Transform([]byte(v))
+		if err != nil {
+			t.Fatalf("transform %s: %v", v, err)
+		}
+		if string(got) != want {
+			t.Errorf("got %s want %s", got, want)
+		}
+	}
+}
+
+func TestTransformRejectsInvalidInput(t *testing.T) {
+	for _, in := range []string{`{"a":1,"a":2}`, `{"a":1} {}`, `[1e400]`, `{"a":}`} {
+		if _, err := Transform([]byte(in)); err == nil {
+			t.Errorf("expected error for %s", in)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Package keys manages the broker's Ed25519 issuer keys: the current signing
+// key, retired keys kept for verification during an overlap window, and their
+// persistence in an encrypted keystore file.
+package keys
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// LegacyKeyID is the kid given to a key imported from
+// BROKER_ED25519_PRIVATE_KEY. It matches the broker's former fixed
+// verification method, and verifies legacy delegation tokens.
+const LegacyKeyID = "broker-key-1"
+
+// Key is an issuer signing key.
+type Key struct {
+	ID      string             `json:"kid"`
+	Private ed25519.PrivateKey `json:"private_key"`
+	Created time.Time          `json:"created"`
+	// Retired is set when the key stops signing. It remains published and
+	// accepted for verification until Expires.
+	Retired *time.Time `json:"retired,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// Public returns the key's public half.
+func (k Key) Public() ed25519.PublicKey {
+	return k.Private.Public().(ed25519.PublicKey)
+}
+
+// Manager holds the current signing key and the retired keys still within
+// their overlap window. It implements vc.SignerSource and vc.KeySet.
+type Manager struct {
+	// Controller prefixes kids to form verification method IDs
+	// (<Controller>#<kid>).
+	Controller string
+	// Aliases are former controllers whose verification method IDs still
+	// resolve, so credentials issued under them verify until they expire.
+	Aliases []string
+	overlap time.Duration
+	store   *Keystore
+	now     func() time.Time
+
+	mu   sync.RWMutex
+	keys []Key // current key last
+}
+
+// NewManager loads the keys in store. A nil store keeps keys in memory only.
+// Retired keys stay valid for overlap after rotation.
+func NewManager(controller string, store *Keystore, overlap time.Duration) (*Manager, error) {
+	m := &Manager{Controller: controller, overlap: overlap, store: store, now: time.Now}
+	if store != nil {
+		keys, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		m.keys = keys
+	}
+	return m, nil
+}
+
+// Import seeds an empty manager with priv as the current key under kid. It
+// does nothing once the manager holds keys, so an existing
+// BROKER_ED25519_PRIVATE_KEY only initialises a new keystore and is then
+// rotated out like any other key.
+func (m *Manager) Import(kid string, priv ed25519.PrivateKey) error {
+	if len(priv) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid ed25519 private key")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.keys) > 0 {
+		return nil
+	}
+	m.keys = append(m.keys, Key{ID: kid, Private: priv, Created: m.now().UTC()})
+	return m.save()
+}
+
+// Current returns the signer for the current key, generating one if the
+// manager holds no keys yet.
+func (m *Manager) Current() vc.Signer {
+	m.mu.RLock()
+	if n := len(m.keys); n > 0 && m.keys[n-1].Retired == nil {
+		k := m.keys[n-1]
+		m.mu.RUnlock()
+		return m.signer(k)
+	}
+	m.mu.RUnlock()
+	k, err := m.Rotate()
+	if err != nil {
+		// Without a key nothing can be issued; the error is logged and the
+		// empty key makes signing fail.
+		log.Printf("key generation failed: %v", err)
+	}
+	return m.signer(k)
+}
+
+// Rotate generates a new current key, retires the previous one and drops
+// keys whose overlap window has passed.
+func (m *Manager) Rotate() (Key, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+	now := m.now().UTC()
+	k := Key{ID: newKeyID(now), Private: priv, Created: now}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retireCurrent()
+	m.prune()
+	m.keys = append(m.keys, k)
+	return k, m.save()
+}
+
+// RotateIfDue rotates when the current key is older than maxAge.
+func (m *Manager) RotateIfDue(maxAge time.Duration) (bool, error) {
+	m.mu.RLock()
+	due := true
+	if n := len(m.keys); n > 0 && m.keys[n-1].Retired == nil {
+		due = m.now().Sub(m.keys[n-1].Created) >= maxAge
+	}
+	m.mu.RUnlock()
+	if !due {
+		return false, nil
+	}
+	_, err := m.Rotate()
+	return err == nil, err
+}
+
+// Run rotates the current key every maxAge until ctx is done, checking once
+// per interval.
+func (m *Manager) Run(ctx context.Context, maxAge, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rotated, err := m.RotateIfDue(maxAge)
+			if err != nil {
+				log.Printf("key rotation failed: %v", err)
+			} else if rotated {
+				log.Printf("rotated broker signing key")
+			}
+		}
+	}
+}
+
+// Keys returns the current key and the retired keys still being accepted.
+func (m *Manager) Keys() []Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := m.now()
+	var out []Key
+	for _, k := range m.keys {
+		if k.Expires == nil || now.Before(*k.Expires) {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// PublicKey resolves <Controller>#<kid>, or <alias>#<kid> for any of
+// Aliases, to an unexpired key. The empty verification method used by legacy
+// tokens resolves to LegacyKeyID.
+func (m *Manager) PublicKey(verificationMethod, _ string) (ed25519.PublicKey, error) {
+	kid := LegacyKeyID
+	if verificationMethod != "" {
+		var ok bool
+		for _, c := range append([]string{m.Controller}, m.Aliases...) {
+			if kid, ok = strings.CutPrefix(verificationMethod, c+"#"); ok {
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown verification method %q", verificationMethod)
+		}
+	}
+	for _, k := range m.Keys() {
+		if k.ID == kid {
+			return k.Public(), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown verification method %q", verificationMethod)
+}
+
+// JWKS returns the public keys as a JSON Web Key Set.
+func (m *Manager) JWKS() JWKS {
+	set := JWKS{Keys: []*vc.JWK{}}
+	for _, k := range m.Keys() {
+		jwk := vc.JWKFromEd25519(k.Public())
+		jwk.Kid = k.ID
+		jwk.Alg, jwk.Use = "EdDSA", "sig"
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// DIDDocument returns the DID document of Controller. Every published key is
+// an assertion method; only the current key authenticates.
+func (m *Manager) DIDDocument() *did.Document {
+	doc := &did.Document{
+		Context:            []string{did.ContextDIDv1, did.ContextMultikey},
+		ID:                 m.Controller,
+		VerificationMethod: []did.VerificationMethod{},
+		AssertionMethod:    []string{},
+	}
+	keys := m.Keys()
+	for _, k := range keys {
+		mb, err := did.EncodeMultikey(k.Public())
+		if err != nil {
+			continue
+		}
+		id := m.Controller + "#" + k.ID
+		doc.VerificationMethod = append(doc.VerificationMethod, did.VerificationMethod{
+			ID:                 id,
+			Type:               "Multikey",
+			Controller:         m.Controller,
+			PublicKeyMultibase: mb,
+		})
+		doc.AssertionMethod = append(doc.AssertionMethod, id)
+	}
+	if n := len(keys); n > 0 && keys[n-1].Retired == nil {
+		doc.Authentication = []string{m.Controller + "#" + keys[n-1].ID}
+	}
+	return doc
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []*vc.JWK `json:"keys"`
+}
+
+func (m *Manager) signer(k Key) vc.Signer {
+	return vc.Signer{VerificationMethod: m.Controller + "#" + k.ID, Key: k.Private}
+}
+
+// retireCurrent must be called with m.mu held.
+func (m *Manager) retireCurrent() {
+	n := len(m.keys)
+	if n == 0 || m.keys[n-1].Retired != nil {
+		return
+	}
+	now := m.now().UTC()
+	expires := now.Add(m.overlap)
+	m.keys[n-1].Retired = &now
+	m.keys[n-1].Expires = &expires
+}
+
+// prune must be called with m.mu held.
+func (m *Manager) prune() {
+	now := m.now()
+	kept := m.keys[:0]
+	for _, k := range m.keys {
+		if k.Expires == nil || now.Before(*k.Expires) {
+			kept = append(kept, k)
+		}
+	}
+	m.keys = kept
+}
+
+// save must be called with m.mu held.
+func (m *Manager) save() error {
+	if m.store == nil {
+		return nil
+	}
+	return m.store.Save(m.keys)
+}
+
+func newKeyID(t time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return "key-" + t.Format("20060102") + "-" + hex.EncodeToString(b)
+}
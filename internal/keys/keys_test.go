@@ -0,0 +1,127 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+func testKeystore(t *testing.T, path, passphrase string) *Keystore {
+	t.Helper()
+	ks, err := NewKeystore(path, passphrase)
+	if err != nil {
+		t.Fatalf("keystore: %v", err)
+	}
+	ks.iterations = 1000
+	return ks
+}
+
+func TestKeystoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	m, err := NewManager("did:example:broker", testKeystore(t, path, "secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("manager: %v", err)
+	}
+	signer := m.Current()
+
+	raw, _ := os.ReadFile(path)
+	if strings.Contains(string(raw), "kid") {
+		t.Fatal("keystore file is not encrypted")
+	}
+
+	reopened, err := NewManager("did:example:broker", testKeystore(t, path, "secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got := reopened.Current(); got.VerificationMethod != signer.VerificationMethod || !got.Key.Equal(signer.Key) {
+		t.Fatal("current key not persisted")
+	}
+
+	if _, err := NewManager("did:example:broker", testKeystore(t, path, "wrong"), time.Hour); err == nil {
+		t.Fatal("wrong passphrase accepted")
+	}
+}
+
+func TestRotationOverlap(t *testing.T) {
+	now := time.Now()
+	m, _ := NewManager("did:example:broker", nil, time.Hour)
+	m.now = func() time.Time { return now }
+
+	old := m.Current()
+	cred, err := vc.IssueDelegation("did:example:broker", "did:example:agent", map[string]interface{}{"role": "r"}, time.Hour, old)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	raw, _ := json.Marshal(cred)
+
+	if _, err := m.Rotate(); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if m.Current().VerificationMethod == old.VerificationMethod {
+		t.Fatal("rotation did not change the signing key")
+	}
+	if len(m.JWKS().Keys) != 2 {
+		t.Fatalf("expected current and retired key published, got %d", len(m.JWKS().Keys))
+	}
+	for _, k := range m.JWKS().Keys {
+		if k.Alg != "EdDSA" || k.Use != "sig" {
+			t.Fatalf("published key without alg and use: %+v", k)
+		}
+	}
+	if _, err := vc.ParseCredential(raw, m); err != nil {
+		t.Fatalf("credential signed by retired key rejected within overlap: %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := vc.ParseCredential(raw, m); err == nil {
+		t.Fatal("retired key accepted after overlap")
+	}
+	if rotated, _ := m.RotateIfDue(time.Hour); !rotated {
+		t.Fatal("expected rotation once the current key is older than maxAge")
+	}
+	if len(m.Keys()) != 2 {
+		t.Fatalf("expired key not pruned: %d keys", len(m.Keys()))
+	}
+}
+
+func TestDIDDocument(t *testing.T) {
+	m, _ := NewManager("did:web:broker.example", nil, time.Hour)
+	old := m.Current()
+	m.Rotate()
+	cur := m.Current()
+
+	doc := m.DIDDocument()
+	if doc.ID != "did:web:broker.example" || len(doc.VerificationMethod) != 2 || len(doc.AssertionMethod) != 2 {
+		t.Fatalf("unexpected document: %+v", doc)
+	}
+	if len(doc.Authentication) != 1 || doc.Authentication[0] != cur.VerificationMethod {
+		t.Fatalf("authentication = %v, want current key %s", doc.Authentication, cur.VerificationMethod)
+	}
+	vm, ok := doc.Method(old.VerificationMethod)
+	if !ok {
+		t.Fatalf("retired key %s not listed", old.VerificationMethod)
+	}
+	pub, err := did.DecodeMultikey(vm.PublicKeyMultibase)
+	if err != nil || !old.Key.Public().(ed25519.PublicKey).Equal(pub) {
+		t.Fatalf("retired key mismatch: %v", err)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	m, _ := NewManager("did:web:broker.example", nil, time.Hour)
+	m.Aliases = []string{"http://keycloak/realm"}
+	kid := strings.TrimPrefix(m.Current().VerificationMethod, m.Controller+"#")
+	if _, err := m.PublicKey("http://keycloak/realm#"+kid, ""); err != nil {
+		t.Fatalf("alias rejected: %v", err)
+	}
+	if _, err := m.PublicKey("did:web:other#"+kid, ""); err == nil {
+		t.Fatal("foreign controller accepted")
+	}
+}
@@ -0,0 +1,124 @@
+package keys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	keystoreVersion = 1
+	kdfName         = "pbkdf2-sha256"
+	kdfIterations   = 600000
+)
+
+// Keystore persists keys in a file encrypted with AES-256-GCM under a key
+// derived from a passphrase with PBKDF2-SHA256.
+type Keystore struct {
+	path       string
+	passphrase string
+	iterations int
+}
+
+// keystoreFile is the on-disk envelope; the ciphertext holds the JSON
+// encoded []Key.
+type keystoreFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// NewKeystore returns a keystore for the file at path.
+func NewKeystore(path, passphrase string) (*Keystore, error) {
+	if passphrase == "" {
+		return nil, errors.New("keystore passphrase required")
+	}
+	return &Keystore{path: path, passphrase: passphrase, iterations: kdfIterations}, nil
+}
+
+// Load decrypts the keystore. A missing file holds no keys.
+func (s *Keystore) Load() ([]Key, error) {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f keystoreFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	if f.Version != keystoreVersion || f.KDF != kdfName {
+		return nil, fmt.Errorf("keystore: unsupported version %d / kdf %q", f.Version, f.KDF)
+	}
+	aead, err := s.aead(f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("keystore: wrong passphrase or corrupted file")
+	}
+	var keys []Key
+	if err := json.Unmarshal(plain, &keys); err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	return keys, nil
+}
+
+// Save encrypts keys with a fresh salt and nonce and replaces the file.
+func (s *Keystore) Save(keys []Key) error {
+	plain, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	f := keystoreFile{
+		Version:    keystoreVersion,
+		KDF:        kdfName,
+		Iterations: s.iterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	aead, err := s.aead(f.Salt, f.Iterations)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plain, nil)
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *Keystore) aead(salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, s.passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
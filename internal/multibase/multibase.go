@@ -0,0 +1,89 @@
+package multibase
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Base58BTC is the multibase prefix for base58btc encoded values.
+const Base58BTC = 'z'
+
+// Base64URL is the multibase prefix for unpadded base64url encoded values.
+const Base64URL = 'u'
+
+// Encode encodes data using the given multibase prefix.
+func Encode(base rune, data []byte) (string, error) {
+	switch base {
+	case Base58BTC:
+		return string(Base58BTC) + encodeBase58(data), nil
+	case Base64URL:
+		return string(Base64URL) + base64.RawURLEncoding.EncodeToString(data), nil
+	default:
+		return "", fmt.Errorf("unsupported multibase prefix %q", base)
+	}
+}
+
+// Decode decodes a multibase string, returning the raw bytes.
+func Decode(s string) ([]byte, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty multibase value")
+	}
+	switch rune(s[0]) {
+	case Base58BTC:
+		return decodeBase58(s[1:])
+	case Base64URL:
+		return base64.RawURLEncoding.DecodeString(s[1:])
+	default:
+		return nil, fmt.Errorf("unsupported multibase prefix %q", s[0])
+	}
+}
+
+func encodeBase58(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for i := 0; i < zeros; i++ {
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func decodeBase58(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	for _, c := range []byte(s) {
+		idx := -1
+		for i := 0; i < len(base58Alphabet); i++ {
+			if base58Alphabet[i] == c {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+	b := n.Bytes()
+	return append(make([]byte, zeros), b...), nil
+}
@@ -0,0 +1,61 @@
+package nonce
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// ErrInvalid is returned for unknown, expired or already used nonces.
+var ErrInvalid = vc.NewError(vc.CodeChallengeInvalid, "invalid or used challenge")
+
+// Store issues single-use nonces that expire after a fixed TTL.
+type Store struct {
+	ttl    time.Duration
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewStore creates an in-memory nonce store.
+func NewStore(ttl time.Duration) *Store {
+	return &Store{ttl: ttl, nonces: map[string]time.Time{}}
+}
+
+// Issue creates a new nonce and returns it with its expiry.
+func (s *Store) Issue() (string, time.Time, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	n := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	expires := now.Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, exp := range s.nonces {
+		if now.After(exp) {
+			delete(s.nonces, k)
+		}
+	}
+	s.nonces[n] = expires
+	return n, expires, nil
+}
+
+// Consume accepts a nonce exactly once before it expires.
+func (s *Store) Consume(n string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.nonces[n]
+	if !ok {
+		return ErrInvalid
+	}
+	delete(s.nonces, n)
+	if time.Now().After(exp) {
+		return ErrInvalid
+	}
+	return nil
+}
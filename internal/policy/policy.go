@@ -1,6 +1,6 @@
 package policy
 
-import "errors"
+import "github.com/bradtumy/agent-identity-poc/internal/vc"
 
 var allowedActions = []string{"fetch_data", "transform", "notify"}
 
@@ -23,12 +23,17 @@ func IsActionAllowedForRole(role, action string) bool {
 	return false
 }
 
+// ValidatePolicy checks that role may perform action. Failures are
+// *vc.VerificationError values with code role_missing or action_denied.
 func ValidatePolicy(action, role string) error {
+	if role == "" {
+		return vc.NewError(vc.CodeRoleMissing, "credential has no role")
+	}
 	if !contains(allowedActions, action) {
-		return errors.New("action not allowed")
+		return vc.NewError(vc.CodeActionDenied, "action not allowed")
 	}
 	if !IsActionAllowedForRole(role, action) {
-		return errors.New("role not permitted to perform action")
+		return vc.NewError(vc.CodeActionDenied, "role not permitted to perform action")
 	}
 	return nil
 }
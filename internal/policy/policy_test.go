@@ -1,6 +1,11 @@
 package policy
 
-import "testing"
+import (
+	"errors"
+	"testing"
+
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
 
 func TestIsActionAllowedForRole(t *testing.T) {
 	if !IsActionAllowedForRole("data-fetcher", "fetch_data") {
@@ -22,6 +27,7 @@ func TestValidatePolicy(t *testing.T) {
 		{"transform", "transformer", false},
 		{"notify", "unknown", true},
 		{"unknown", "data-fetcher", true},
+		{"fetch_data", "", true},
 	}
 	for _, tc := range tests {
 		err := ValidatePolicy(tc.action, tc.role)
@@ -33,3 +39,13 @@ func TestValidatePolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestValidatePolicyCodes(t *testing.T) {
+	var verr *vc.VerificationError
+	if err := ValidatePolicy("fetch_data", ""); !errors.As(err, &verr) || verr.Code != vc.CodeRoleMissing {
+		t.Errorf("missing role: got %v", err)
+	}
+	if err := ValidatePolicy("notify", "data-fetcher"); !errors.As(err, &verr) || verr.Code != vc.CodeActionDenied {
+		t.Errorf("denied action: got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+// Package problem writes RFC 9457 problem details responses.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ContentType is the media type of a problem details response.
+const ContentType = "application/problem+json"
+
+// TypeBase prefixes the type URI of problems that carry a code. The
+// reference is resolved against the broker URL.
+const TypeBase = "/problems/"
+
+// Details is a problem details object.
+type Details struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Code is a stable machine-readable error code; clients should branch
+	// on it rather than on Title or Detail.
+	Code string `json:"code,omitempty"`
+	// Schema and Errors describe credential schema violations.
+	Schema string      `json:"schema,omitempty"`
+	Errors interface{} `json:"errors,omitempty"`
+}
+
+// New returns a problem of the type identified by code.
+func New(status int, code, title, detail string) Details {
+	return Details{
+		Type:   TypeBase + code,
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Write writes p with its status code.
+func Write(w http.ResponseWriter, p Details) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error replies with an untyped problem; it is the problem+json counterpart
+// of http.Error.
+func Error(w http.ResponseWriter, detail string, status int) {
+	Write(w, Details{Status: status, Detail: detail})
+}
@@ -0,0 +1,38 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Error(rr, "missing fields", http.StatusBadRequest)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != ContentType {
+		t.Fatalf("content type %q", ct)
+	}
+	var p Details
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != "about:blank" || p.Title != "Bad Request" || p.Status != 400 || p.Detail != "missing fields" || p.Code != "" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+}
+
+func TestWriteCoded(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Write(rr, New(http.StatusUnauthorized, "expired", "Credential expired", "credential has expired"))
+	var p Details
+	if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != "/problems/expired" || p.Code != "expired" || p.Status != 401 {
+		t.Errorf("unexpected problem %+v", p)
+	}
+}
@@ -0,0 +1,170 @@
+// Package schema hosts the broker's versioned credential JSON Schemas and
+// validates credentials against them.
+//
+// Only the subset of JSON Schema (draft 2020-12) used by the broker's own
+// schemas is implemented: type, enum, const, required, properties,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum, maximum and the date-time and uri formats. Schemas using
+// other keywords are rejected when registered.
+package schema
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is the credentialSchema type for JSON Schema references.
+const Type = "JsonSchema"
+
+//go:embed schemas
+var builtin embed.FS
+
+// FieldError reports one failed constraint.
+type FieldError struct {
+	// Field is a JSON Pointer to the offending value, e.g.
+	// /credentialSubject/metadata/role.
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every constraint a document failed.
+type ValidationError struct {
+	Schema string       `json:"schema"`
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "schema validation failed: " + strings.Join(parts, "; ")
+}
+
+type entry struct {
+	credType string
+	version  string
+	raw      []byte
+	root     map[string]interface{}
+}
+
+// Registry holds schemas by ID. Schema IDs have the form
+// <baseURL>/schemas/<credential type>/<version>.
+type Registry struct {
+	baseURL string
+	mu      sync.RWMutex
+	schemas map[string]*entry
+}
+
+// NewRegistry returns a registry with the built-in schemas hosted under
+// baseURL.
+func NewRegistry(baseURL string) (*Registry, error) {
+	r := &Registry{baseURL: strings.TrimRight(baseURL, "/"), schemas: map[string]*entry{}}
+	err := fs.WalkDir(builtin, "schemas", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		raw, err := builtin.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		credType := path.Base(path.Dir(p))
+		version := strings.TrimSuffix(path.Base(p), ".json")
+		return r.Register(credType, version, raw)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ID returns the schema ID for a credential type and version.
+func (r *Registry) ID(credType, version string) string {
+	return r.baseURL + "/schemas/" + credType + "/" + version
+}
+
+// Register adds a schema for credType at version.
+func (r *Registry) Register(credType, version string, raw []byte) error {
+	var root map[string]interface{}
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return fmt.Errorf("schema %s/%s: %w", credType, version, err)
+	}
+	if err := checkKeywords(root, ""); err != nil {
+		return fmt.Errorf("schema %s/%s: %w", credType, version, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[r.ID(credType, version)] = &entry{credType: credType, version: version, raw: raw, root: root}
+	return nil
+}
+
+// Get returns the raw schema document with the given ID.
+func (r *Registry) Get(id string) ([]byte, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.schemas[id]
+	if !ok {
+		return nil, false
+	}
+	return e.raw, true
+}
+
+// Latest returns the ID of the newest schema version for credType.
+func (r *Registry) Latest(credType string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var versions []string
+	for _, e := range r.schemas {
+		if e.credType == credType {
+			versions = append(versions, e.version)
+		}
+	}
+	if len(versions) == 0 {
+		return "", false
+	}
+	sort.Slice(versions, func(i, j int) bool { return versionLess(versions[i], versions[j]) })
+	return r.ID(credType, versions[len(versions)-1]), true
+}
+
+// Validate checks doc, a value decoded by encoding/json, against the schema
+// with the given ID. Constraint failures are returned as *ValidationError.
+func (r *Registry) Validate(id string, doc interface{}) error {
+	r.mu.RLock()
+	e, ok := r.schemas[id]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown credential schema %s", id)
+	}
+	var errs []FieldError
+	validate(e.root, doc, "", &errs)
+	if len(errs) > 0 {
+		return &ValidationError{Schema: id, Errors: errs}
+	}
+	return nil
+}
+
+// versionLess orders dotted numeric versions such as 1.0 < 1.2 < 1.10.
+func versionLess(a, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		x, errX := strconv.Atoi(as[i])
+		y, errY := strconv.Atoi(bs[i])
+		if errX != nil || errY != nil {
+			if as[i] != bs[i] {
+				return as[i] < bs[i]
+			}
+			continue
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return len(as) < len(bs)
+}
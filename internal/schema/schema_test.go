@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return v
+}
+
+func TestValidateAgentDelegation(t *testing.T) {
+	r, err := NewRegistry("http://broker.example/")
+	if err != nil {
+		t.Fatalf("registry: %v", err)
+	}
+	id, ok := r.Latest("AgentDelegation")
+	if !ok || id != "http://broker.example/schemas/AgentDelegation/1.0" {
+		t.Fatalf("unexpected latest schema %q", id)
+	}
+
+	valid := decode(t, `{
+		"@context": ["https://www.w3.org/2018/credentials/v1"],
+		"type": ["VerifiableCredential", "AgentDelegation"],
+		"issuer": "did:example:issuer",
+		"issuanceDate": "2025-01-01T00:00:00Z",
+		"credentialSubject": {"id": "did:example:agent", "metadata": {"role": "data-fetcher", "actions": ["fetch_data"]}}
+	}`)
+	if err := r.Validate(id, valid); err != nil {
+		t.Fatalf("valid credential rejected: %v", err)
+	}
+
+	invalid := decode(t, `{
+		"@context": ["https://www.w3.org/2018/credentials/v1"],
+		"type": ["VerifiableCredential", "AgentDelegation"],
+		"issuer": "did:example:issuer",
+		"issuanceDate": "yesterday",
+		"credentialSubject": {"id": "did:example:agent", "metadata": {"role": "", "actions": "fetch_data", "extra": 1}}
+	}`)
+	err = r.Validate(id, invalid)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	want := map[string]string{
+		"/issuanceDate":                       "must be an RFC 3339 date-time",
+		"/credentialSubject/metadata/role":    "must not be empty",
+		"/credentialSubject/metadata/actions": "must be of type array",
+		"/credentialSubject/metadata/extra":   "is not allowed",
+	}
+	if len(verr.Errors) != len(want) {
+		t.Fatalf("unexpected errors: %+v", verr.Errors)
+	}
+	for _, fe := range verr.Errors {
+		if want[fe.Field] != fe.Message {
+			t.Errorf("%s: got %q, want %q", fe.Field, fe.Message, want[fe.Field])
+		}
+	}
+}
+
+func TestRegisterVersions(t *testing.T) {
+	r, _ := NewRegistry("http://broker.example")
+	if err := r.Register("AgentDelegation", "1.10", []byte(`{"type": "object"}`)); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if err := r.Register("AgentDelegation", "1.2", []byte(`{"type": "object"}`)); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	if id, _ := r.Latest("AgentDelegation"); id != "http://broker.example/schemas/AgentDelegation/1.10" {
+		t.Fatalf("unexpected latest schema %q", id)
+	}
+	if err := r.Register("AgentDelegation", "2.0", []byte(`{"oneOf": []}`)); err == nil {
+		t.Fatal("schema with unsupported keyword accepted")
+	}
+}
@@ -0,0 +1,247 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// keywords lists the supported keywords; annotations are accepted and ignored.
+var keywords = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"examples": true, "default": true,
+	"type": true, "enum": true, "const": true, "required": true, "properties": true,
+	"additionalProperties": true, "items": true, "minItems": true, "maxItems": true,
+	"minLength": true, "maxLength": true, "pattern": true, "minimum": true,
+	"maximum": true, "format": true,
+}
+
+// checkKeywords rejects schemas that rely on unsupported keywords, which
+// would otherwise be silently ignored.
+func checkKeywords(node map[string]interface{}, ptr string) error {
+	for k, v := range node {
+		if !keywords[k] {
+			return fmt.Errorf("%s: unsupported keyword %q", ptrOrRoot(ptr), k)
+		}
+		switch k {
+		case "properties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: properties must be an object", ptrOrRoot(ptr))
+			}
+			for name, sub := range props {
+				subNode, ok := sub.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("%s/properties/%s: schema must be an object", ptr, name)
+				}
+				if err := checkKeywords(subNode, ptr+"/properties/"+name); err != nil {
+					return err
+				}
+			}
+		case "items", "additionalProperties":
+			if subNode, ok := v.(map[string]interface{}); ok {
+				if err := checkKeywords(subNode, ptr+"/"+k); err != nil {
+					return err
+				}
+			}
+		case "pattern":
+			s, _ := v.(string)
+			if _, err := regexp.Compile(s); err != nil {
+				return fmt.Errorf("%s: invalid pattern: %w", ptrOrRoot(ptr), err)
+			}
+		}
+	}
+	return nil
+}
+
+func validate(node map[string]interface{}, value interface{}, ptr string, errs *[]FieldError) {
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, FieldError{Field: ptrOrRoot(ptr), Message: fmt.Sprintf(format, args...)})
+	}
+
+	if t, ok := node["type"]; ok && !matchesType(t, value) {
+		fail("must be of type %s", typeNames(t))
+		return
+	}
+	if enum, ok := node["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %v", enum)
+		}
+	}
+	if c, ok := node["const"]; ok && !reflect.DeepEqual(c, value) {
+		fail("must be %v", c)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		validateObject(node, v, ptr, errs)
+	case []interface{}:
+		if n, ok := number(node["minItems"]); ok && float64(len(v)) < n {
+			fail("must have at least %v items", n)
+		}
+		if n, ok := number(node["maxItems"]); ok && float64(len(v)) > n {
+			fail("must have at most %v items", n)
+		}
+		if items, ok := node["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validate(items, item, fmt.Sprintf("%s/%d", ptr, i), errs)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := number(node["minLength"]); ok && length < n {
+			if n == 1 {
+				fail("must not be empty")
+			} else {
+				fail("must be at least %v characters", n)
+			}
+		}
+		if n, ok := number(node["maxLength"]); ok && length > n {
+			fail("must be at most %v characters", n)
+		}
+		if p, ok := node["pattern"].(string); ok {
+			if !regexp.MustCompile(p).MatchString(v) {
+				fail("must match pattern %s", p)
+			}
+		}
+		if f, ok := node["format"].(string); ok {
+			if msg := checkFormat(f, v); msg != "" {
+				fail("%s", msg)
+			}
+		}
+	case float64:
+		if n, ok := number(node["minimum"]); ok && v < n {
+			fail("must be at least %v", n)
+		}
+		if n, ok := number(node["maximum"]); ok && v > n {
+			fail("must be at most %v", n)
+		}
+	}
+}
+
+func validateObject(node map[string]interface{}, obj map[string]interface{}, ptr string, errs *[]FieldError) {
+	if required, ok := node["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, present := obj[name]; !present {
+				*errs = append(*errs, FieldError{Field: ptr + "/" + escape(name), Message: "is required"})
+			}
+		}
+	}
+	props, _ := node["properties"].(map[string]interface{})
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := ptr + "/" + escape(name)
+		if sub, ok := props[name].(map[string]interface{}); ok {
+			validate(sub, obj[name], field, errs)
+			continue
+		}
+		switch extra := node["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				*errs = append(*errs, FieldError{Field: field, Message: "is not allowed"})
+			}
+		case map[string]interface{}:
+			validate(extra, obj[name], field, errs)
+		}
+	}
+}
+
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return isType(t, value)
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok && isType(s, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isType(name string, value interface{}) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+func typeNames(t interface{}) string {
+	if list, ok := t.([]interface{}); ok {
+		names := make([]string, len(list))
+		for i, n := range list {
+			names[i] = fmt.Sprint(n)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func checkFormat(format, s string) string {
+	switch format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return "must be an RFC 3339 date-time"
+		}
+	case "uri":
+		if u, err := url.Parse(s); err != nil || u.Scheme == "" {
+			return "must be an absolute URI"
+		}
+	}
+	return ""
+}
+
+func number(v interface{}) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// escape encodes a property name as a JSON Pointer reference token.
+func escape(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+func ptrOrRoot(ptr string) string {
+	if ptr == "" {
+		return "/"
+	}
+	return ptr
+}
@@ -0,0 +1,223 @@
+package statuslist
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bradtumy/agent-identity-poc/internal/multibase"
+)
+
+// Status purposes supported by the broker.
+const (
+	PurposeRevocation = "revocation"
+	PurposeSuspension = "suspension"
+)
+
+// MinSize is the minimum bitstring length recommended for herd privacy.
+const MinSize = 131072
+
+// List is a bitstring where each bit holds the status of one credential.
+type List struct {
+	bits []byte
+}
+
+// New creates a list able to hold size entries.
+func New(size int) *List {
+	return &List{bits: make([]byte, (size+7)/8)}
+}
+
+// Len returns the number of entries the list can hold.
+func (l *List) Len() int {
+	return len(l.bits) * 8
+}
+
+// Get reports whether the bit at index is set.
+func (l *List) Get(index int) (bool, error) {
+	if index < 0 || index >= l.Len() {
+		return false, fmt.Errorf("status index %d out of range", index)
+	}
+	// Bit 0 is the most significant bit of the first byte.
+	return l.bits[index/8]&(0x80>>(index%8)) != 0, nil
+}
+
+// Set sets or clears the bit at index.
+func (l *List) Set(index int, value bool) error {
+	if index < 0 || index >= l.Len() {
+		return fmt.Errorf("status index %d out of range", index)
+	}
+	if value {
+		l.bits[index/8] |= 0x80 >> (index % 8)
+	} else {
+		l.bits[index/8] &^= 0x80 >> (index % 8)
+	}
+	return nil
+}
+
+// Encode GZIP-compresses the bitstring and multibase (base64url) encodes it
+// as the encodedList value of a BitstringStatusList.
+func (l *List) Encode() (string, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(l.bits); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return multibase.Encode(multibase.Base64URL, buf.Bytes())
+}
+
+// Decode parses an encodedList value.
+func Decode(encoded string) (*List, error) {
+	compressed, err := multibase.Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	bits, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	return &List{bits: bits}, nil
+}
+
+// FileStore keeps the broker's revocation and suspension lists on disk and
+// hands out status list indexes to newly issued credentials.
+type FileStore struct {
+	path    string
+	baseURL string
+	mu      sync.Mutex
+	next    int
+	lists   map[string]*List
+}
+
+type fileData struct {
+	NextIndex int               `json:"next_index"`
+	Lists     map[string]string `json:"lists"`
+}
+
+// NewFileStore creates a file backed store at path. Lists are published
+// under baseURL + "/status/<purpose>".
+func NewFileStore(path, baseURL string) (*FileStore, error) {
+	fs := &FileStore{path: path, baseURL: strings.TrimRight(baseURL, "/"), lists: map[string]*List{
+		PurposeRevocation: New(MinSize),
+		PurposeSuspension: New(MinSize),
+	}}
+	if err := fs.load(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func (fs *FileStore) load() error {
+	b, err := os.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var data fileData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return err
+	}
+	fs.next = data.NextIndex
+	for purpose, encoded := range data.Lists {
+		l, err := Decode(encoded)
+		if err != nil {
+			return fmt.Errorf("status list %s: %w", purpose, err)
+		}
+		fs.lists[purpose] = l
+	}
+	return nil
+}
+
+func (fs *FileStore) save() error {
+	data := fileData{NextIndex: fs.next, Lists: map[string]string{}}
+	for purpose, l := range fs.lists {
+		encoded, err := l.Encode()
+		if err != nil {
+			return err
+		}
+		data.Lists[purpose] = encoded
+	}
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fs.path, b, 0644)
+}
+
+// Allocate reserves the next free index. The same index is used in every
+// purpose's list.
+func (fs *FileStore) Allocate() (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.next >= MinSize {
+		return 0, fmt.Errorf("status list is full")
+	}
+	idx := fs.next
+	fs.next++
+	return idx, fs.save()
+}
+
+// Set updates the status bit for index in the list for purpose.
+func (fs *FileStore) Set(purpose string, index int, value bool) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	l, ok := fs.lists[purpose]
+	if !ok {
+		return fmt.Errorf("unknown status purpose %q", purpose)
+	}
+	if err := l.Set(index, value); err != nil {
+		return err
+	}
+	return fs.save()
+}
+
+// Get reports the status bit for index in the list for purpose.
+func (fs *FileStore) Get(purpose string, index int) (bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	l, ok := fs.lists[purpose]
+	if !ok {
+		return false, fmt.Errorf("unknown status purpose %q", purpose)
+	}
+	return l.Get(index)
+}
+
+// Encoded returns the encodedList value for purpose.
+func (fs *FileStore) Encoded(purpose string) (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	l, ok := fs.lists[purpose]
+	if !ok {
+		return "", fmt.Errorf("unknown status purpose %q", purpose)
+	}
+	return l.Encode()
+}
+
+// ListURL returns the URL at which the status list credential for purpose
+// is published.
+func (fs *FileStore) ListURL(purpose string) string {
+	return fs.baseURL + "/status/" + purpose
+}
+
+// Status reports the status bit for an entry that points at one of this
+// store's lists.
+func (fs *FileStore) Status(listURL, purpose string, index int) (bool, error) {
+	if listURL != fs.ListURL(purpose) {
+		return false, fmt.Errorf("unknown status list %s", listURL)
+	}
+	return fs.Get(purpose, index)
+}
@@ -0,0 +1,75 @@
+package statuslist
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestListEncodeDecode(t *testing.T) {
+	l := New(MinSize)
+	for _, idx := range []int{0, 7, 8, 94567, MinSize - 1} {
+		if err := l.Set(idx, true); err != nil {
+			t.Fatalf("set %d: %v", idx, err)
+		}
+	}
+	encoded, err := l.Encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if encoded[0] != 'u' {
+		t.Fatalf("expected base64url multibase prefix, got %q", encoded[0])
+	}
+	decoded, err := Decode(encoded)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.Len() != MinSize {
+		t.Fatalf("unexpected length %d", decoded.Len())
+	}
+	for idx, want := range map[int]bool{0: true, 1: false, 7: true, 8: true, 9: false, 94567: true, MinSize - 1: true} {
+		got, err := decoded.Get(idx)
+		if err != nil || got != want {
+			t.Errorf("index %d: got %v (%v) want %v", idx, got, err, want)
+		}
+	}
+	if _, err := decoded.Get(MinSize); err == nil {
+		t.Errorf("out of range index accepted")
+	}
+}
+
+func TestFileStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "status.json")
+	fs, err := NewFileStore(path, "http://broker/")
+	if err != nil {
+		t.Fatalf("new store: %v", err)
+	}
+	first, _ := fs.Allocate()
+	second, _ := fs.Allocate()
+	if first == second {
+		t.Fatalf("allocated duplicate index %d", first)
+	}
+	if err := fs.Set(PurposeRevocation, second, true); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	reloaded, err := NewFileStore(path, "http://broker")
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if idx, _ := reloaded.Allocate(); idx != second+1 {
+		t.Fatalf("expected next index %d, got %d", second+1, idx)
+	}
+	url := reloaded.ListURL(PurposeRevocation)
+	if url != "http://broker/status/revocation" {
+		t.Fatalf("unexpected list url %s", url)
+	}
+	if set, err := reloaded.Status(url, PurposeRevocation, second); err != nil || !set {
+		t.Fatalf("revocation not persisted: %v %v", set, err)
+	}
+	if set, _ := reloaded.Status(url, PurposeRevocation, first); set {
+		t.Fatalf("unexpected revocation of index %d", first)
+	}
+	if _, err := reloaded.Status("http://elsewhere/status/revocation", PurposeRevocation, first); err == nil {
+		t.Fatalf("foreign status list accepted")
+	}
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+// Errors returned by document updates.
+var (
+	ErrDeactivated       = errors.New("agent DID is deactivated")
+	ErrImmutableDocument = errors.New("did:key documents are fixed by the key")
+)
+
+// DocumentVersion is one version of an agent's DID document. Version IDs
+// count from 1.
+type DocumentVersion struct {
+	VersionID   int          `json:"version_id"`
+	Updated     time.Time    `json:"updated"`
+	Document    did.Document `json:"document"`
+	Deactivated bool         `json:"deactivated,omitempty"`
+}
+
+// Versions returns the versions of the agent's DID document, oldest first.
+// Agents stored before documents were versioned have an implicit first
+// version listing their holder key.
+func (a Agent) Versions() []DocumentVersion {
+	if len(a.DocumentVersions) > 0 {
+		return a.DocumentVersions
+	}
+	doc, err := InitialDocument(a)
+	if err != nil {
+		return nil
+	}
+	return []DocumentVersion{{VersionID: 1, Document: *doc}}
+}
+
+// Deactivated reports whether the agent's DID has been deactivated.
+func (a Agent) Deactivated() bool {
+	versions := a.Versions()
+	return len(versions) > 0 && versions[len(versions)-1].Deactivated
+}
+
+// HoldsKey reports whether key is an authentication key of the agent's
+// current DID document. Agents with no keys on record hold any key.
+func (a Agent) HoldsKey(key *vc.JWK) bool {
+	versions := a.Versions()
+	if len(versions) == 0 {
+		return true
+	}
+	current := versions[len(versions)-1]
+	doc := current.Document
+	if len(doc.VerificationMethod) == 0 && !current.Deactivated {
+		return true
+	}
+	mb, err := key.Multibase()
+	if err != nil {
+		return false
+	}
+	for _, vm := range doc.VerificationMethod {
+		id := vm.ID
+		if strings.HasPrefix(id, "#") {
+			id = doc.ID + id
+		}
+		if vm.PublicKeyMultibase == mb && doc.HasRelationship(vc.PurposeAuthentication, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// InitialDocument returns the first DID document of an agent: the
+// method-defined document of a did:key, or otherwise one listing the holder
+// key as key-1 for authentication and assertions.
+func InitialDocument(a Agent) (*did.Document, error) {
+	if strings.HasPrefix(a.DID, did.KeyPrefix) {
+		return did.ResolveKey(a.DID)
+	}
+	doc := &did.Document{
+		Context:            []string{did.ContextDIDv1, did.ContextMultikey},
+		ID:                 a.DID,
+		VerificationMethod: []did.VerificationMethod{},
+	}
+	if a.HolderKey != nil {
+		mb, err := a.HolderKey.Multibase()
+		if err != nil {
+			return nil, err
+		}
+		vmID := a.DID + "#key-1"
+		doc.VerificationMethod = append(doc.VerificationMethod, did.VerificationMethod{
+			ID:                 vmID,
+			Type:               "Multikey",
+			Controller:         a.DID,
+			PublicKeyMultibase: mb,
+		})
+		doc.Authentication = []string{vmID}
+		doc.AssertionMethod = []string{vmID}
+	}
+	return doc, nil
+}
+
+// UpdateDocument applies update to a copy of the agent's current DID
+// document and stores the result as a new version, whose ID update is given.
+func (fs *FileStore) UpdateDocument(id string, update func(doc *did.Document, version int) error) (DocumentVersion, error) {
+	return fs.appendVersion(id, false, update)
+}
+
+// Deactivate stores a final, deactivated version of the agent's DID
+// document with no verification methods or services.
+func (fs *FileStore) Deactivate(id string) (DocumentVersion, error) {
+	return fs.appendVersion(id, true, func(doc *did.Document, _ int) error {
+		*doc = did.Document{Context: doc.Context, ID: doc.ID, VerificationMethod: []did.VerificationMethod{}}
+		return nil
+	})
+}
+
+func (fs *FileStore) appendVersion(id string, deactivate bool, update func(*did.Document, int) error) (DocumentVersion, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	a, ok := fs.data[id]
+	if !ok {
+		return DocumentVersion{}, ErrAgentNotFound
+	}
+	if strings.HasPrefix(id, did.KeyPrefix) {
+		return DocumentVersion{}, ErrImmutableDocument
+	}
+	versions := a.Versions()
+	if len(versions) == 0 {
+		return DocumentVersion{}, fmt.Errorf("agent %s has no DID document", id)
+	}
+	last := versions[len(versions)-1]
+	if last.Deactivated {
+		return DocumentVersion{}, ErrDeactivated
+	}
+	doc := last.Document.Clone()
+	if err := update(doc, last.VersionID+1); err != nil {
+		return DocumentVersion{}, err
+	}
+	next := DocumentVersion{
+		VersionID:   last.VersionID + 1,
+		Updated:     time.Now().UTC().Truncate(time.Second),
+		Document:    *doc,
+		Deactivated: deactivate,
+	}
+	a.DocumentVersions = append(slices.Clip(versions), next)
+	fs.data[id] = a
+	return next, fs.save()
+}
+
+// CheckSubject implements vc.SubjectChecker. A registered agent's
+// credentials stop verifying once its DID is deactivated, or once the key
+// bound into them is no longer an authentication key of its DID document.
+func (fs *FileStore) CheckSubject(cred *vc.Credential) error {
+	a, ok := fs.Get(cred.CredentialSubject.ID)
+	if !ok {
+		return nil
+	}
+	if a.Deactivated() {
+		return vc.NewError(vc.CodeRevoked, "agent DID %s is deactivated", a.DID)
+	}
+	if cred.Cnf != nil && cred.Cnf.JWK != nil && !a.HoldsKey(cred.Cnf.JWK) {
+		return vc.NewError(vc.CodeRevoked, "holder key is no longer a key of %s", a.DID)
+	}
+	return nil
+}
+
+// Resolve implements did.Resolver for agent DIDs, returning the current
+// version of the document. Deactivated DIDs resolve as not found.
+func (fs *FileStore) Resolve(_ context.Context, id string) (*did.Document, error) {
+	a, ok := fs.Get(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", did.ErrNotFound, id)
+	}
+	versions := a.Versions()
+	if len(versions) == 0 || a.Deactivated() {
+		return nil, fmt.Errorf("%w: %s", did.ErrNotFound, id)
+	}
+	return versions[len(versions)-1].Document.Clone(), nil
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrAlreadyExchanged is returned by ExchangeLog.Record for a legacy token
+// that has been exchanged before.
+var ErrAlreadyExchanged = errors.New("legacy token already exchanged")
+
+// Exchange records the credential a legacy token was exchanged for.
+type Exchange struct {
+	CredentialID string    `json:"credential_id"`
+	StatusIndex  int       `json:"status_index"`
+	Exchanged    time.Time `json:"exchanged"`
+}
+
+// ExchangeLog records exchanged legacy tokens in a JSON file, keyed by the
+// ID of the converted legacy credential, so that each token is exchanged
+// only once.
+type ExchangeLog struct {
+	path string
+	mu   sync.Mutex
+	data map[string]Exchange
+}
+
+// NewExchangeLog creates a file backed log at path.
+func NewExchangeLog(path string) *ExchangeLog {
+	l := &ExchangeLog{path: path, data: map[string]Exchange{}}
+	if b, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(b, &l.data)
+	}
+	return l
+}
+
+// Record marks legacyID as exchanged. It fails with ErrAlreadyExchanged if
+// it already was, so concurrent exchanges of one token cannot both succeed.
+func (l *ExchangeLog) Record(legacyID string, e Exchange) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.data[legacyID]; ok {
+		return ErrAlreadyExchanged
+	}
+	l.data[legacyID] = e
+	b, err := json.MarshalIndent(l.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.path, b, 0644)
+}
+
+// Get returns the exchange recorded for legacyID.
+func (l *ExchangeLog) Get(legacyID string) (Exchange, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.data[legacyID]
+	return e, ok
+}
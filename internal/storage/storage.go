@@ -2,8 +2,12 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"os"
+	"slices"
 	"sync"
+
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
 )
 
 // Agent stores agent identity information on disk.
@@ -12,8 +16,29 @@ type Agent struct {
 	Owner      string                 `json:"owner"`
 	Metadata   map[string]interface{} `json:"metadata"`
 	Credential interface{}            `json:"credential"`
+	// HolderKey is the agent key proven at registration and bound into
+	// its credentials.
+	HolderKey *vc.JWK `json:"holder_key,omitempty"`
+	// StatusIndex is the credential's position in the broker status lists.
+	StatusIndex *int `json:"status_index,omitempty"`
+	// CredentialIDs lists the IDs of every credential issued to the agent,
+	// oldest first; Credential holds the newest.
+	CredentialIDs []string `json:"credential_ids,omitempty"`
+	// Aliases are pairwise did:peer identifiers the agent has registered.
+	// The linkage to DID is private to the broker and never published.
+	Aliases []string `json:"aliases,omitempty"`
+	// DocumentVersions holds every version of the agent's DID document,
+	// oldest first.
+	DocumentVersions []DocumentVersion `json:"document_versions,omitempty"`
 }
 
+// Errors returned by AddAlias, Update and document updates.
+var (
+	ErrAgentNotFound = errors.New("agent not found")
+	ErrAgentExists   = errors.New("agent already registered")
+	ErrAliasTaken    = errors.New("alias registered to another agent")
+)
+
 // FileStore stores agents to a JSON file.
 type FileStore struct {
 	path string
@@ -51,3 +76,52 @@ func (fs *FileStore) Save(a Agent) error {
 	fs.data[a.DID] = a
 	return fs.save()
 }
+
+// Update applies update to the agent record for id and stores the result,
+// holding the store lock throughout so that it cannot overwrite a document
+// change or alias made since the record was read. update receives a zero
+// Agent when id is not stored. Nothing is stored if update returns an error
+// or leaves the DID empty.
+func (fs *FileStore) Update(id string, update func(a *Agent) error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	a := fs.data[id]
+	if err := update(&a); err != nil {
+		return err
+	}
+	if a.DID == "" {
+		return nil
+	}
+	fs.data[id] = a
+	return fs.save()
+}
+
+// Get returns the agent record for did.
+func (fs *FileStore) Get(did string) (Agent, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	a, ok := fs.data[did]
+	return a, ok
+}
+
+// AddAlias records alias as a pairwise identifier of the agent did. Adding
+// an alias the agent already has is a no-op.
+func (fs *FileStore) AddAlias(did, alias string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	a, ok := fs.data[did]
+	if !ok {
+		return ErrAgentNotFound
+	}
+	for id, other := range fs.data {
+		if id == alias || slices.Contains(other.Aliases, alias) {
+			if id == did {
+				return nil
+			}
+			return ErrAliasTaken
+		}
+	}
+	a.Aliases = append(a.Aliases, alias)
+	fs.data[did] = a
+	return fs.save()
+}
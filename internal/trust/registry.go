@@ -0,0 +1,203 @@
+// Package trust loads the trusted issuer registry from the broker's YAML
+// configuration and keeps it current while the broker runs.
+package trust
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is config/config.yaml.
+type Config struct {
+	TrustedIssuers []IssuerConfig `yaml:"trusted_issuers"`
+	// Authorization is the broker's route authorization section, decoded
+	// with DecodeAuthorization.
+	Authorization yaml.Node `yaml:"authorization"`
+}
+
+// IssuerConfig describes one trusted issuer.
+type IssuerConfig struct {
+	ID string `yaml:"id"`
+	// Keys are the issuer's Ed25519 verification keys as JWKs. The kid is
+	// the fragment of the verification method in the issuer's proofs.
+	Keys            []vc.JWK `yaml:"keys"`
+	CredentialTypes []string `yaml:"credential_types"`
+	Roles           []string `yaml:"roles"`
+	// MaxLifetime maps roles to the longest lifetime of a renewed
+	// credential, as a Go duration (e.g. 24h).
+	MaxLifetime map[string]string `yaml:"max_lifetime"`
+}
+
+type issuer struct {
+	vc.TrustedIssuer
+	keys map[string]ed25519.PublicKey
+}
+
+// Registry is the trusted issuer registry. It implements vc.IssuerRegistry,
+// and vc.KeySet for the keys listed in the configuration.
+type Registry struct {
+	path string
+	vars map[string]string
+
+	mu            sync.RWMutex
+	issuers       map[string]issuer
+	authorization yaml.Node
+	modTime       time.Time
+}
+
+// Load reads the registry from the YAML file at path. ${VAR} references are
+// expanded from vars, falling back to the environment.
+func Load(path string, vars map[string]string) (*Registry, error) {
+	r := &Registry{path: path, vars: vars}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the configuration file. On error the previous registry is
+// kept.
+func (r *Registry) Reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	var cfg Config
+	if err := yaml.Unmarshal([]byte(os.Expand(string(b), r.lookup)), &cfg); err != nil {
+		return fmt.Errorf("%s: %w", r.path, err)
+	}
+	issuers, err := parse(cfg)
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.path, err)
+	}
+	r.mu.Lock()
+	r.issuers = issuers
+	r.authorization = cfg.Authorization
+	r.modTime = info.ModTime()
+	r.mu.Unlock()
+	return nil
+}
+
+// lookup returns the value of a ${VAR} reference in the configuration.
+func (r *Registry) lookup(name string) string {
+	if v, ok := r.vars[name]; ok {
+		return v
+	}
+	return os.Getenv(name)
+}
+
+// Watch reloads the registry whenever the file's modification time changes,
+// checking once per interval until ctx is done.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(r.path)
+			if err != nil {
+				log.Printf("trust registry: %v", err)
+				continue
+			}
+			r.mu.RLock()
+			changed := !info.ModTime().Equal(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				log.Printf("trust registry reload failed, keeping previous registry: %v", err)
+				continue
+			}
+			log.Printf("trust registry reloaded from %s", r.path)
+		}
+	}
+}
+
+// TrustedIssuer implements vc.IssuerRegistry.
+func (r *Registry) TrustedIssuer(id string) (vc.TrustedIssuer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	iss, ok := r.issuers[id]
+	return iss.TrustedIssuer, ok
+}
+
+// PublicKey implements vc.KeySet by resolving <issuer>#<kid> against the
+// configured keys.
+func (r *Registry) PublicKey(verificationMethod, _ string) (ed25519.PublicKey, error) {
+	id, kid, ok := strings.Cut(verificationMethod, "#")
+	if ok {
+		r.mu.RLock()
+		pub, found := r.issuers[id].keys[kid]
+		r.mu.RUnlock()
+		if found {
+			return pub, nil
+		}
+	}
+	return nil, fmt.Errorf("no configured key for verification method %q", verificationMethod)
+}
+
+// DecodeAuthorization decodes the authorization section of the
+// configuration as last loaded into v, so that it is read with the same
+// ${VAR} expansion as the trusted issuers.
+func (r *Registry) DecodeAuthorization(v interface{}) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.authorization.IsZero() {
+		return nil
+	}
+	return r.authorization.Decode(v)
+}
+
+func parse(cfg Config) (map[string]issuer, error) {
+	issuers := make(map[string]issuer, len(cfg.TrustedIssuers))
+	for _, ic := range cfg.TrustedIssuers {
+		if ic.ID == "" {
+			return nil, fmt.Errorf("trusted issuer without id")
+		}
+		if _, dup := issuers[ic.ID]; dup {
+			return nil, fmt.Errorf("duplicate trusted issuer %s", ic.ID)
+		}
+		iss := issuer{
+			TrustedIssuer: vc.TrustedIssuer{ID: ic.ID, CredentialTypes: ic.CredentialTypes, Roles: ic.Roles},
+			keys:          map[string]ed25519.PublicKey{},
+		}
+		if len(ic.MaxLifetime) > 0 {
+			iss.MaxLifetime = map[string]time.Duration{}
+		}
+		for role, d := range ic.MaxLifetime {
+			lifetime, err := time.ParseDuration(d)
+			if err != nil || lifetime <= 0 {
+				return nil, fmt.Errorf("issuer %s: invalid max_lifetime for %s: %q", ic.ID, role, d)
+			}
+			iss.MaxLifetime[role] = lifetime
+		}
+		for _, k := range ic.Keys {
+			if k.Kid == "" {
+				return nil, fmt.Errorf("issuer %s: key without kid", ic.ID)
+			}
+			pub, err := k.PublicKey()
+			if err != nil {
+				return nil, fmt.Errorf("issuer %s key %s: %w", ic.ID, k.Kid, err)
+			}
+			iss.keys[k.Kid] = pub
+		}
+		issuers[ic.ID] = iss
+	}
+	return issuers, nil
+}
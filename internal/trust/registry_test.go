@@ -0,0 +1,98 @@
+package trust
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/vc"
+)
+
+const partner = "did:example:partner"
+
+func writeConfig(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	x := vc.JWKFromEd25519(pub).X
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `
+trusted_issuers:
+  - id: "`+partner+`"
+    keys:
+      - {kid: key-1, kty: OKP, crv: Ed25519, x: "`+x+`"}
+    credential_types: [AgentDelegation]
+    roles: [data-fetcher]
+`)
+	reg, err := Load(path, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	signer := vc.Signer{VerificationMethod: partner + "#key-1", Key: priv}
+	cred, err := vc.IssueDelegation(partner, "did:example:agent", map[string]interface{}{"role": "data-fetcher"}, time.Hour, signer)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	raw, _ := json.Marshal(cred)
+	parsed, err := vc.ParseCredential(raw, reg)
+	if err != nil {
+		t.Fatalf("configured key not used: %v", err)
+	}
+	if err := vc.CheckTrustedIssuer(parsed, reg); err != nil {
+		t.Fatalf("trusted issuer rejected: %v", err)
+	}
+
+	admin := vc.NewDelegation(partner, "did:example:agent", map[string]interface{}{"role": "admin"}, time.Hour)
+	if err := vc.CheckTrustedIssuer(admin, reg); err == nil {
+		t.Fatal("role outside the issuer's allowed roles accepted")
+	}
+
+	// Removing the issuer takes effect on reload.
+	writeConfig(t, path, "trusted_issuers: []\n")
+	if err := reg.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if err := vc.CheckTrustedIssuer(parsed, reg); err == nil {
+		t.Fatal("issuer still trusted after reload")
+	}
+
+	// A broken file leaves the previous registry in place.
+	writeConfig(t, path, "trusted_issuers: [")
+	if err := reg.Reload(); err == nil {
+		t.Fatal("invalid config accepted")
+	}
+}
+
+func TestRegistryExpandsVars(t *testing.T) {
+	t.Setenv("BROKER_DID", "did:web:env.example")
+	t.Setenv("PARTNER_DID", "did:web:partner.example")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, `
+trusted_issuers:
+  - id: "${BROKER_DID}"
+    roles: [data-fetcher]
+  - id: "${PARTNER_DID}"
+`)
+	reg, err := Load(path, map[string]string{"BROKER_DID": "did:web:broker.example"})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, ok := reg.TrustedIssuer("did:web:broker.example"); !ok {
+		t.Fatal("issuer id not expanded from the given variables")
+	}
+	if _, ok := reg.TrustedIssuer("did:web:env.example"); ok {
+		t.Fatal("environment preferred over the given variables")
+	}
+	if _, ok := reg.TrustedIssuer("did:web:partner.example"); !ok {
+		t.Fatal("issuer id not expanded from the environment")
+	}
+}
@@ -0,0 +1,219 @@
+package vc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrChainTooDeep is returned when a delegation chain exceeds the allowed depth.
+var ErrChainTooDeep = errors.New("delegation chain too deep")
+
+// maxEmbeddedDepth bounds recursion while verifying proofs, before the
+// configured depth limit is applied.
+const maxEmbeddedDepth = 16
+
+// Metadata keys used to attenuate delegated authority.
+const (
+	MetaActions     = "actions"
+	MetaConstraints = "constraints"
+)
+
+// Chain returns the credential followed by its embedded ancestors, ending
+// with the root credential issued by the broker.
+func (c *Credential) Chain() []*Credential {
+	var chain []*Credential
+	for cur := c; cur != nil; cur = cur.ParentCredential {
+		chain = append(chain, cur)
+	}
+	return chain
+}
+
+// Root returns the credential at the top of the delegation chain.
+func (c *Credential) Root() *Credential {
+	chain := c.Chain()
+	return chain[len(chain)-1]
+}
+
+// IssueSubDelegation lets the holder of parent delegate part of its
+// authority to another agent. The child is issued by the parent's subject,
+// embeds the parent and is signed with the parent's holder key. subjectKey,
+// when set, allows the new subject to delegate further.
+func IssueSubDelegation(parent *Credential, subjectDID string, subjectKey *JWK, metadata map[string]interface{}, ttl time.Duration, holder Signer) (*Credential, error) {
+	child := NewDelegation(parent.CredentialSubject.ID, subjectDID, metadata, ttl)
+	child.ParentCredential = parent
+	child.CredentialSchema = parent.CredentialSchema
+	if subjectKey != nil {
+		child.Cnf = &Confirmation{JWK: subjectKey}
+	}
+	if err := checkAttenuation(parent, child); err != nil {
+		return nil, err
+	}
+	if err := Sign(child, holder); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
+
+// verifyChainProofs verifies the root proof with the broker key and every
+// other proof with the holder key bound into the parent credential.
+func verifyChainProofs(cred *Credential, keys KeySet, depth int) error {
+	if cred.ParentCredential == nil {
+		if cred.Proof == nil {
+			return fmt.Errorf("missing proof")
+		}
+		if err := checkController(cred.Proof.VerificationMethod, cred.Issuer); err != nil {
+			return err
+		}
+		rootKey, err := keys.PublicKey(cred.Proof.VerificationMethod, PurposeAssertion)
+		if err != nil {
+			return err
+		}
+		return VerifySignature(cred, rootKey)
+	}
+	if depth >= maxEmbeddedDepth {
+		return ErrChainTooDeep
+	}
+	parent := cred.ParentCredential
+	if err := verifyChainProofs(parent, keys, depth+1); err != nil {
+		return err
+	}
+	if parent.Cnf == nil || parent.Cnf.JWK == nil {
+		return fmt.Errorf("parent credential has no holder key")
+	}
+	key, err := parent.Cnf.JWK.PublicKey()
+	if err != nil {
+		return err
+	}
+	return VerifySignature(cred, key)
+}
+
+// CheckDelegationChain enforces the depth limit and verifies that every hop
+// is issued by its parent's subject and only narrows the parent's actions,
+// validity period and parameter constraints. Proofs are verified when the
+// credential is parsed.
+func CheckDelegationChain(cred *Credential, maxDepth int) error {
+	chain := cred.Chain()
+	if len(chain)-1 > maxDepth {
+		return ErrChainTooDeep
+	}
+	for i := 0; i < len(chain)-1; i++ {
+		if err := checkAttenuation(chain[i+1], chain[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkAttenuation(parent, child *Credential) error {
+	if child.Issuer != parent.CredentialSubject.ID {
+		return fmt.Errorf("credential issuer %s is not the parent subject", child.Issuer)
+	}
+	if err := CheckNarrowerMetadata(parent.CredentialSubject.Metadata, child.CredentialSubject.Metadata); err != nil {
+		return err
+	}
+
+	parentUntil, err := validUntil(parent)
+	if err != nil {
+		return err
+	}
+	childUntil, err := validUntil(child)
+	if err != nil {
+		return err
+	}
+	if childUntil.After(parentUntil) {
+		return fmt.Errorf("delegated credential outlives its parent")
+	}
+	return nil
+}
+
+// CheckNarrowerMetadata reports whether child metadata grants no more than
+// parent: the same role, a subset of any action restriction and every
+// parameter constraint kept or narrowed.
+func CheckNarrowerMetadata(pm, cm map[string]interface{}) error {
+	if pm["role"] != cm["role"] {
+		return fmt.Errorf("delegated role must match the parent role")
+	}
+
+	parentActions, parentLimited := stringList(pm[MetaActions])
+	childActions, childLimited := stringList(cm[MetaActions])
+	if parentLimited {
+		if !childLimited {
+			return fmt.Errorf("delegated credential must restrict actions")
+		}
+		for _, a := range childActions {
+			if !contains(parentActions, a) {
+				return fmt.Errorf("action %s is not delegable", a)
+			}
+		}
+	}
+
+	parentCons := stringMap(pm[MetaConstraints])
+	childCons := stringMap(cm[MetaConstraints])
+	for param, prefix := range parentCons {
+		narrowed, ok := childCons[param]
+		if !ok || !strings.HasPrefix(narrowed, prefix) {
+			return fmt.Errorf("constraint on %s must be kept or narrowed", param)
+		}
+	}
+	return nil
+}
+
+// CheckTask ensures the task stays within the actions and parameter
+// constraints of the credential.
+func CheckTask(cred *Credential, task Task) error {
+	meta := cred.CredentialSubject.Metadata
+	if actions, limited := stringList(meta[MetaActions]); limited && !contains(actions, task.Action) {
+		return NewError(CodeActionDenied, "action %s not delegated", task.Action)
+	}
+	for param, prefix := range stringMap(meta[MetaConstraints]) {
+		value, ok := task.Params[param].(string)
+		if !ok || !strings.HasPrefix(value, prefix) {
+			return NewError(CodeActionDenied, "parameter %s outside delegated constraint", param)
+		}
+	}
+	return nil
+}
+
+// stringList reads a []string metadata value; ok is false when absent.
+func stringList(v interface{}) ([]string, bool) {
+	switch list := v.(type) {
+	case []string:
+		return list, true
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+func stringMap(v interface{}) map[string]string {
+	out := map[string]string{}
+	switch m := v.(type) {
+	case map[string]string:
+		return m
+	case map[string]interface{}:
+		for k, val := range m {
+			if s, ok := val.(string); ok {
+				out[k] = s
+			}
+		}
+	}
+	return out
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func holderKey(t *testing.T, did string) (Signer, *JWK) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return Signer{VerificationMethod: did + "#holder", Key: priv}, JWKFromEd25519(pub)
+}
+
+func TestDelegationChain(t *testing.T) {
+	broker, brokerPub := testSigner(t)
+	agent, agentJWK := holderKey(t, "did:example:agent")
+	helper, helperJWK := holderKey(t, "did:example:helper")
+
+	root := NewDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:agent", map[string]interface{}{
+		"role":          "data-fetcher",
+		MetaActions:     []string{"fetch_data"},
+		MetaConstraints: map[string]interface{}{"url": "https://api.internal/"},
+	}, time.Hour)
+	root.Cnf = &Confirmation{JWK: agentJWK}
+	if err := Sign(root, broker); err != nil {
+		t.Fatalf("sign root: %v", err)
+	}
+
+	child, err := IssueSubDelegation(root, "did:example:helper", helperJWK, map[string]interface{}{
+		"role":          "data-fetcher",
+		MetaActions:     []string{"fetch_data"},
+		MetaConstraints: map[string]interface{}{"url": "https://api.internal/reports/"},
+	}, 30*time.Minute, agent)
+	if err != nil {
+		t.Fatalf("sub-delegate: %v", err)
+	}
+	grandchild, err := IssueSubDelegation(child, "did:example:worker", nil, map[string]interface{}{
+		"role":          "data-fetcher",
+		MetaActions:     []string{"fetch_data"},
+		MetaConstraints: map[string]interface{}{"url": "https://api.internal/reports/2025/"},
+	}, 10*time.Minute, helper)
+	if err != nil {
+		t.Fatalf("sub-delegate again: %v", err)
+	}
+
+	raw, _ := json.Marshal(grandchild)
+	parsed, err := ParseCredential(raw, StaticKey(brokerPub))
+	if err != nil {
+		t.Fatalf("valid chain rejected: %v", err)
+	}
+	if len(parsed.Chain()) != 3 || parsed.Root().CredentialSubject.ID != "did:example:agent" {
+		t.Fatalf("unexpected chain: %+v", parsed.Chain())
+	}
+	if err := CheckDelegationChain(parsed, 2); err != nil {
+		t.Fatalf("chain within depth rejected: %v", err)
+	}
+	if err := CheckDelegationChain(parsed, 1); err != ErrChainTooDeep {
+		t.Fatalf("expected ErrChainTooDeep, got %v", err)
+	}
+
+	task := Task{Action: "fetch_data", Params: map[string]interface{}{"url": "https://api.internal/reports/2025/q1"}}
+	if err := CheckTask(parsed, task); err != nil {
+		t.Fatalf("task within constraints rejected: %v", err)
+	}
+	task.Params["url"] = "https://api.internal/admin"
+	if err := CheckTask(parsed, task); err == nil {
+		t.Fatalf("task outside constraints accepted")
+	}
+
+	// The helper cannot sign on the agent's behalf.
+	forged := NewDelegation("did:example:agent", "did:example:worker", map[string]interface{}{"role": "data-fetcher", MetaActions: []string{"fetch_data"}, MetaConstraints: map[string]interface{}{"url": "https://api.internal/"}}, time.Minute)
+	forged.ParentCredential = root
+	Sign(forged, helper)
+	raw, _ = json.Marshal(forged)
+	if _, err := ParseCredential(raw, StaticKey(brokerPub)); err == nil {
+		t.Fatalf("child signed with the wrong key accepted")
+	}
+}
+
+func TestSubDelegationCannotWiden(t *testing.T) {
+	broker, _ := testSigner(t)
+	agent, agentJWK := holderKey(t, "did:example:agent")
+	root := NewDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:agent", map[string]interface{}{
+		"role":          "data-fetcher",
+		MetaActions:     []string{"fetch_data"},
+		MetaConstraints: map[string]interface{}{"url": "https://api.internal/"},
+	}, time.Hour)
+	root.Cnf = &Confirmation{JWK: agentJWK}
+	Sign(root, broker)
+
+	tests := []struct {
+		name string
+		meta map[string]interface{}
+		ttl  time.Duration
+	}{
+		{"other role", map[string]interface{}{"role": "notifier", MetaActions: []string{"fetch_data"}, MetaConstraints: map[string]interface{}{"url": "https://api.internal/"}}, time.Minute},
+		{"extra action", map[string]interface{}{"role": "data-fetcher", MetaActions: []string{"fetch_data", "notify"}, MetaConstraints: map[string]interface{}{"url": "https://api.internal/"}}, time.Minute},
+		{"unrestricted actions", map[string]interface{}{"role": "data-fetcher", MetaConstraints: map[string]interface{}{"url": "https://api.internal/"}}, time.Minute},
+		{"dropped constraint", map[string]interface{}{"role": "data-fetcher", MetaActions: []string{"fetch_data"}}, time.Minute},
+		{"wider constraint", map[string]interface{}{"role": "data-fetcher", MetaActions: []string{"fetch_data"}, MetaConstraints: map[string]interface{}{"url": "https://"}}, time.Minute},
+		{"longer ttl", map[string]interface{}{"role": "data-fetcher", MetaActions: []string{"fetch_data"}, MetaConstraints: map[string]interface{}{"url": "https://api.internal/"}}, 2 * time.Hour},
+	}
+	for _, tc := range tests {
+		if _, err := IssueSubDelegation(root, "did:example:helper", nil, tc.meta, tc.ttl, agent); err == nil {
+			t.Errorf("%s: widening sub-delegation accepted", tc.name)
+		}
+	}
+}
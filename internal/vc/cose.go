@@ -0,0 +1,144 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/bradtumy/agent-identity-poc/internal/cbor"
+)
+
+// COSEType is the typ header of COSE-secured credentials. Their payload is
+// the credential's JSON data model encoded as CBOR.
+const COSEType = "application/vc+cose"
+
+// COSE header labels and values (RFC 9052, RFC 9596).
+const (
+	coseTagSign1       = 18
+	coseHeaderAlg      = 1
+	coseHeaderCty      = 3
+	coseHeaderKid      = 4
+	coseHeaderTyp      = 16
+	coseAlgEdDSA       = -8
+	coseContentTypeVC  = "application/cbor"
+	coseSignatureLabel = "Signature1"
+)
+
+// EncodeCOSE signs an unsigned credential as a tagged COSE_Sign1 structure
+// with the credential, as CBOR, for its payload.
+func EncodeCOSE(cred *Credential, signer Signer) ([]byte, error) {
+	if len(signer.Key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid ed25519 signing key")
+	}
+	body := *cred
+	body.Proof = nil
+	raw, err := json.Marshal(&body)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := cbor.FromJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := cbor.Marshal(map[int64]interface{}{
+		coseHeaderAlg: coseAlgEdDSA,
+		coseHeaderCty: coseContentTypeVC,
+		coseHeaderKid: []byte(signer.VerificationMethod),
+		coseHeaderTyp: COSEType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	toSign, err := coseSigStructure(protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(cbor.Tag{Number: coseTagSign1, Content: []interface{}{
+		protected,
+		map[int64]interface{}{},
+		payload,
+		ed25519.Sign(signer.Key, toSign),
+	}})
+}
+
+// DecodeCOSE verifies a COSE_Sign1 credential and returns the credential.
+// The validity period is enforced separately by ValidityChecker.
+func DecodeCOSE(data []byte, keys KeySet) (*Credential, error) {
+	item, err := cbor.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cose: %w", err)
+	}
+	if tag, ok := item.(cbor.Tag); ok {
+		if tag.Number != coseTagSign1 {
+			return nil, fmt.Errorf("unexpected cose tag %d", tag.Number)
+		}
+		item = tag.Content
+	}
+	msg, ok := item.([]interface{})
+	if !ok || len(msg) != 4 {
+		return nil, fmt.Errorf("malformed cose_sign1")
+	}
+	protected, ok1 := msg[0].([]byte)
+	payload, ok2 := msg[2].([]byte)
+	sig, ok3 := msg[3].([]byte)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf("malformed cose_sign1")
+	}
+	h, err := cbor.Unmarshal(protected)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cose header: %w", err)
+	}
+	header, ok := h.(map[int64]interface{})
+	if !ok {
+		return nil, fmt.Errorf("malformed cose header")
+	}
+	if alg, _ := header[coseHeaderAlg].(int64); alg != coseAlgEdDSA {
+		return nil, fmt.Errorf("unsupported cose alg %v", header[coseHeaderAlg])
+	}
+	if typ, _ := header[coseHeaderTyp].(string); typ != COSEType {
+		return nil, fmt.Errorf("unexpected typ %q", typ)
+	}
+	kidBytes, _ := header[coseHeaderKid].([]byte)
+	kid := string(kidBytes)
+	raw, err := cbor.ToJSON(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cose payload: %w", err)
+	}
+	var cred Credential
+	if err := json.Unmarshal(raw, &cred); err != nil {
+		return nil, fmt.Errorf("malformed cose payload: %w", err)
+	}
+	// As for JWTs, the kid must belong to the issuer before it is resolved.
+	if err := checkController(kid, cred.Issuer); err != nil {
+		return nil, err
+	}
+	pub, err := keys.PublicKey(kid, PurposeAssertion)
+	if err != nil {
+		return nil, err
+	}
+	toSign, err := coseSigStructure(protected, payload)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(pub, toSign, sig) {
+		return nil, ErrInvalidProof
+	}
+	return &cred, nil
+}
+
+// decodeCOSEString decodes the base64url text form of a COSE credential
+// used in JSON payloads.
+func decodeCOSEString(s string, keys KeySet) (*Credential, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cose: %w", err)
+	}
+	return DecodeCOSE(data, keys)
+}
+
+// coseSigStructure builds the Sig_structure signed for a COSE_Sign1 message
+// with no external additional data.
+func coseSigStructure(protected, payload []byte) ([]byte, error) {
+	return cbor.Marshal([]interface{}{coseSignatureLabel, protected, []byte{}, payload})
+}
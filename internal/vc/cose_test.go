@@ -0,0 +1,54 @@
+package vc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCOSERoundTrip(t *testing.T) {
+	signer, pub := testSigner(t)
+	cred := NewDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{"role": "data-fetcher", "actions": []string{"fetch_data"}}, time.Hour)
+	cred.Cnf = &Confirmation{JWK: JWKFromEd25519(pub)}
+	data, err := EncodeCOSE(cred, signer)
+	if err != nil {
+		t.Fatalf("encode cose: %v", err)
+	}
+	got, err := DecodeCOSE(data, StaticKey(pub))
+	if err != nil {
+		t.Fatalf("valid cose rejected: %v", err)
+	}
+	if got.ID != cred.ID || got.ValidUntil != cred.ValidUntil || got.Cnf == nil || got.Cnf.JWK.X != cred.Cnf.JWK.X {
+		t.Fatalf("unexpected credential: %+v", got)
+	}
+	if err := CheckTask(got, Task{Action: "notify"}); err == nil {
+		t.Fatalf("decoded actions not enforced")
+	}
+
+	signed := *cred
+	if err := Sign(&signed, signer); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if ldp, _ := json.Marshal(&signed); len(data) >= len(ldp) {
+		t.Errorf("cose credential (%d bytes) not smaller than ldp_vc (%d bytes)", len(data), len(ldp))
+	}
+
+	_, otherPub := testSigner(t)
+	if _, err := DecodeCOSE(data, StaticKey(otherPub)); err == nil {
+		t.Fatalf("cose with wrong key accepted")
+	}
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-70] ^= 1
+	if _, err := DecodeCOSE(tampered, StaticKey(pub)); err == nil {
+		t.Fatalf("tampered cose accepted")
+	}
+
+	encoded, err := Encode(cred, FormatCOSE, signer)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	raw, _ := json.Marshal(encoded)
+	if _, err := ParseCredential(raw, StaticKey(pub)); err != nil {
+		t.Fatalf("ParseCredential rejected cose string: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package vc
+
+import "fmt"
+
+// Code is a stable, machine-readable verification failure code.
+type Code string
+
+// Verification failure codes.
+const (
+	CodeSignatureInvalid    Code = "signature_invalid"
+	CodePresentationInvalid Code = "presentation_invalid"
+	CodeChallengeInvalid    Code = "challenge_invalid"
+	CodeIssuerUntrusted     Code = "issuer_untrusted"
+	CodeExpired             Code = "expired"
+	CodeNotYetValid         Code = "not_yet_valid"
+	CodeRevoked             Code = "revoked"
+	CodeSuspended           Code = "suspended"
+	CodeStatusUnavailable   Code = "status_unavailable"
+	CodeChainInvalid        Code = "chain_invalid"
+	CodeSchemaInvalid       Code = "schema_invalid"
+	CodeRoleMissing         Code = "role_missing"
+	CodeActionDenied        Code = "action_denied"
+	CodeCallLimitExceeded   Code = "call_limit_exceeded"
+)
+
+// VerificationError is a failed credential or authorization check.
+type VerificationError struct {
+	Code   Code
+	Detail string
+	// Err is the underlying cause, if any.
+	Err error
+}
+
+// NewError returns a VerificationError with a formatted detail message.
+func NewError(code Code, format string, args ...interface{}) *VerificationError {
+	return &VerificationError{Code: code, Detail: fmt.Sprintf(format, args...)}
+}
+
+// wrapError attaches code to err.
+func wrapError(code Code, err error) *VerificationError {
+	return &VerificationError{Code: code, Err: err}
+}
+
+func (e *VerificationError) Error() string {
+	msg := string(e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is a VerificationError with the same code, so
+// errors.Is(err, ErrExpired) holds for any expiry failure.
+func (e *VerificationError) Is(target error) bool {
+	t, ok := target.(*VerificationError)
+	return ok && t.Code == e.Code
+}
+
+// Message returns the detail text without the code prefix.
+func (e *VerificationError) Message() string {
+	switch {
+	case e.Detail != "" && e.Err != nil:
+		return e.Detail + ": " + e.Err.Error()
+	case e.Detail != "":
+		return e.Detail
+	case e.Err != nil:
+		return e.Err.Error()
+	}
+	return string(e.Code)
+}
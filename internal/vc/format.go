@@ -0,0 +1,94 @@
+package vc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Credential encodings supported by the broker.
+const (
+	FormatLDP   = "ldp_vc"
+	FormatJWT   = "jwt_vc"
+	FormatSDJWT = "vc+sd-jwt"
+	FormatCOSE  = "vc+cose"
+)
+
+// SupportedFormat reports whether Encode can produce format.
+func SupportedFormat(format string) bool {
+	switch format {
+	case FormatLDP, FormatJWT, FormatSDJWT, FormatCOSE:
+		return true
+	}
+	return false
+}
+
+// Encode signs an unsigned credential in the requested format. LDP
+// credentials are returned as *Credential, JWT-VCs and SD-JWTs as strings,
+// and COSE credentials as unpadded base64url strings.
+func Encode(cred *Credential, format string, signer Signer) (interface{}, error) {
+	switch format {
+	case "", FormatLDP:
+		if err := Sign(cred, signer); err != nil {
+			return nil, err
+		}
+		return cred, nil
+	case FormatJWT:
+		return EncodeJWT(cred, signer)
+	case FormatSDJWT:
+		return EncodeSDJWT(cred, signer)
+	case FormatCOSE:
+		data, err := EncodeCOSE(cred, signer)
+		if err != nil {
+			return nil, err
+		}
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported credential format %q", format)
+	}
+}
+
+// ParseCredential detects the encoding of a credential taken from a request
+// payload, verifies its proof and returns the decoded credential. A JSON
+// string is an SD-JWT if it contains disclosure separators, a JWT-VC if it
+// contains dots and a base64url COSE_Sign1 otherwise. A JSON object is a
+// LegacyDelegationToken if it has that shape. Otherwise it is an LDP
+// credential, and its embedded delegation chain is verified back to a key in
+// keys.
+func ParseCredential(raw json.RawMessage, keys KeySet) (*Credential, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("missing credential")
+	}
+	switch raw[0] {
+	case '"':
+		var token string
+		if err := json.Unmarshal(raw, &token); err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.Contains(token, "~"):
+			return DecodeSDJWT(token, keys)
+		case strings.Contains(token, "."):
+			return DecodeJWT(token, keys)
+		default:
+			return decodeCOSEString(token, keys)
+		}
+	case '{':
+		if isLegacyToken(raw) {
+			return parseLegacyToken(raw, keys)
+		}
+		var cred Credential
+		if err := json.Unmarshal(raw, &cred); err != nil {
+			return nil, err
+		}
+		if err := verifyChainProofs(&cred, keys, 0); err != nil {
+			return nil, err
+		}
+		return &cred, nil
+	default:
+		return nil, fmt.Errorf("unrecognized credential encoding")
+	}
+}
@@ -0,0 +1,82 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+)
+
+// JWK is a JSON Web Key holding an Ed25519 public key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid,omitempty"`
+	// Alg and Use are set on published signing keys ("EdDSA", "sig").
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+// Confirmation binds a credential to a key held by its subject.
+type Confirmation struct {
+	JWK *JWK `json:"jwk"`
+}
+
+// JWKFromEd25519 wraps an Ed25519 public key as a JWK.
+func JWKFromEd25519(pub ed25519.PublicKey) *JWK {
+	return &JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)}
+}
+
+// JWKFromMultibase parses a publicKeyMultibase value holding a
+// multicodec-prefixed Ed25519 public key, such as "z6Mk...".
+func JWKFromMultibase(s string) (*JWK, error) {
+	pub, err := did.DecodeMultikey(s)
+	if err != nil {
+		return nil, err
+	}
+	edPub, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("publicKeyMultibase is not an ed25519-pub key")
+	}
+	return JWKFromEd25519(edPub), nil
+}
+
+// Multibase returns the key as a base58btc publicKeyMultibase value.
+func (k *JWK) Multibase() (string, error) {
+	pub, err := k.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	return did.EncodeMultikey(pub)
+}
+
+// VerifyPossession checks that signature, unpadded base64url, is the key's
+// Ed25519 signature over challenge.
+func (k *JWK) VerifyPossession(challenge, signature string) error {
+	pub, err := k.PublicKey()
+	if err != nil {
+		return err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(pub, []byte(challenge), sig) {
+		return NewError(CodeSignatureInvalid, "challenge signature does not verify with the agent key")
+	}
+	return nil
+}
+
+// PublicKey returns the Ed25519 key described by the JWK.
+func (k *JWK) PublicKey() (ed25519.PublicKey, error) {
+	if k.Kty != "OKP" || k.Crv != "Ed25519" {
+		return nil, fmt.Errorf("unsupported jwk %s/%s", k.Kty, k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwk x: %w", err)
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 key length %d", len(x))
+	}
+	return ed25519.PublicKey(x), nil
+}
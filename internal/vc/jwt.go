@@ -0,0 +1,156 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JWTType is the media type used in the typ header of JWT-VCs.
+const JWTType = "vc+jwt"
+
+const algEdDSA = "EdDSA"
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// JWTClaims is the payload of a JWT-VC.
+type JWTClaims struct {
+	Issuer    string      `json:"iss"`
+	Subject   string      `json:"sub"`
+	NotBefore int64       `json:"nbf"`
+	Expires   int64       `json:"exp,omitempty"`
+	ID        string      `json:"jti"`
+	VC        *Credential `json:"vc"`
+}
+
+// EncodeJWT signs an unsigned credential as a compact JWS JWT-VC.
+func EncodeJWT(cred *Credential, signer Signer) (string, error) {
+	body := *cred
+	body.Proof = nil
+	claims, err := jwtClaims(&body)
+	if err != nil {
+		return "", err
+	}
+	header := jwtHeader{Alg: algEdDSA, Typ: JWTType, Kid: signer.VerificationMethod}
+	return signJWS(header, claims, signer.Key)
+}
+
+// DecodeJWT verifies a JWT-VC and returns the embedded credential.
+// The validity period is enforced separately by ValidityChecker.
+func DecodeJWT(token string, keys KeySet) (*Credential, error) {
+	var claims JWTClaims
+	header, err := verifyJWS(token, keys, &claims)
+	if err != nil {
+		return nil, err
+	}
+	if header.Typ != JWTType {
+		return nil, fmt.Errorf("unexpected typ %q", header.Typ)
+	}
+	return credentialFromClaims(&claims)
+}
+
+// jwtClaims maps a credential onto the registered JWT claims.
+func jwtClaims(cred *Credential) (JWTClaims, error) {
+	from, err := validFrom(cred)
+	if err != nil {
+		return JWTClaims{}, err
+	}
+	claims := JWTClaims{
+		Issuer:    cred.Issuer,
+		Subject:   cred.CredentialSubject.ID,
+		NotBefore: from.Unix(),
+		ID:        cred.ID,
+		VC:        cred,
+	}
+	if exp, err := validUntil(cred); err == nil {
+		claims.Expires = exp.Unix()
+	}
+	return claims, nil
+}
+
+// credentialFromClaims returns the vc claim after checking it agrees with
+// the registered claims.
+func credentialFromClaims(claims *JWTClaims) (*Credential, error) {
+	if claims.VC == nil {
+		return nil, fmt.Errorf("missing vc claim")
+	}
+	cred := claims.VC
+	if cred.Issuer != claims.Issuer || cred.CredentialSubject.ID != claims.Subject {
+		return nil, fmt.Errorf("vc claim does not match iss/sub")
+	}
+	if cred.ID != claims.ID {
+		return nil, fmt.Errorf("vc claim does not match jti")
+	}
+	return cred, nil
+}
+
+func signJWS(header jwtHeader, claims interface{}, key ed25519.PrivateKey) (string, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return "", fmt.Errorf("invalid ed25519 signing key")
+	}
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	sig := ed25519.Sign(key, []byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func verifyJWS(token string, keys KeySet, claims interface{}) (*jwtHeader, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed jwt")
+	}
+	hb, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt header: %w", err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(hb, &header); err != nil {
+		return nil, fmt.Errorf("malformed jwt header: %w", err)
+	}
+	if header.Alg != algEdDSA {
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+	pb, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	// The kid must belong to the claimed issuer before it is resolved, so
+	// a token cannot make the verifier resolve arbitrary keys.
+	var iss struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(pb, &iss); err != nil {
+		return nil, fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	if err := checkController(header.Kid, iss.Issuer); err != nil {
+		return nil, err
+	}
+	pub, err := keys.PublicKey(header.Kid, PurposeAssertion)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt signature: %w", err)
+	}
+	if !ed25519.Verify(pub, []byte(parts[0]+"."+parts[1]), sig) {
+		return nil, ErrInvalidProof
+	}
+	if err := json.Unmarshal(pb, claims); err != nil {
+		return nil, fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	return &header, nil
+}
@@ -0,0 +1,34 @@
+package vc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJWTRoundTrip(t *testing.T) {
+	signer, pub := testSigner(t)
+	cred := NewDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{"role": "data-fetcher", "token_ttl": 3600}, 0)
+	token, err := EncodeJWT(cred, signer)
+	if err != nil {
+		t.Fatalf("encode jwt: %v", err)
+	}
+	got, err := DecodeJWT(token, StaticKey(pub))
+	if err != nil {
+		t.Fatalf("valid jwt rejected: %v", err)
+	}
+	if got.CredentialSubject.ID != "did:example:123" || got.ID != cred.ID {
+		t.Fatalf("unexpected credential: %+v", got)
+	}
+	if err := ValidateTTL(got); err != nil {
+		t.Fatalf("valid ttl rejected: %v", err)
+	}
+
+	_, otherPub := testSigner(t)
+	if _, err := DecodeJWT(token, StaticKey(otherPub)); err == nil {
+		t.Fatalf("jwt with wrong key accepted")
+	}
+	parts := strings.Split(token, ".")
+	if _, err := DecodeJWT(parts[0]+"."+parts[0]+"."+parts[2], StaticKey(pub)); err == nil {
+		t.Fatalf("tampered jwt accepted")
+	}
+}
@@ -0,0 +1,102 @@
+package vc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+)
+
+// KeySet resolves the verification method named by a proof (or a JWT kid)
+// to the Ed25519 public key that must have produced it. purpose is
+// PurposeAssertion for issuer proofs and PurposeAuthentication for
+// presentation proofs. Legacy delegation tokens name no verification method
+// and are resolved with "".
+type KeySet interface {
+	PublicKey(verificationMethod, purpose string) (ed25519.PublicKey, error)
+}
+
+// StaticKey is a KeySet that verifies every issuer proof with one key.
+type StaticKey ed25519.PublicKey
+
+// PublicKey returns the key regardless of verificationMethod.
+func (k StaticKey) PublicKey(string, string) (ed25519.PublicKey, error) {
+	if len(k) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key")
+	}
+	return ed25519.PublicKey(k), nil
+}
+
+// KeySets tries each KeySet in turn and returns the first key found.
+type KeySets []KeySet
+
+// PublicKey implements KeySet.
+func (ks KeySets) PublicKey(verificationMethod, purpose string) (ed25519.PublicKey, error) {
+	errs := make([]error, 0, len(ks))
+	for _, k := range ks {
+		pub, err := k.PublicKey(verificationMethod, purpose)
+		if err == nil {
+			return pub, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// DIDKeys is a KeySet that resolves DID verification methods
+// (<did>#<fragment>) with a did.Resolver. The method must be listed under
+// the verification relationship matching the proof purpose, and only
+// Ed25519 keys are returned.
+type DIDKeys struct {
+	Resolver did.Resolver
+	// Timeout bounds each resolution; zero means 10 seconds.
+	Timeout time.Duration
+}
+
+// PublicKey implements KeySet.
+func (k DIDKeys) PublicKey(verificationMethod, purpose string) (ed25519.PublicKey, error) {
+	id, _, ok := strings.Cut(verificationMethod, "#")
+	if !ok || !strings.HasPrefix(id, "did:") {
+		return nil, fmt.Errorf("not a DID verification method %q", verificationMethod)
+	}
+	timeout := k.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	doc, err := k.Resolver.Resolve(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	vm, ok := doc.Method(verificationMethod)
+	if !ok {
+		return nil, fmt.Errorf("verification method %q not in DID document", verificationMethod)
+	}
+	if !doc.HasRelationship(purpose, verificationMethod) {
+		return nil, fmt.Errorf("verification method %q is not authorized for %s", verificationMethod, purpose)
+	}
+	pub, err := vm.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	edPub, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("verification method %q is not an ed25519 key", verificationMethod)
+	}
+	return edPub, nil
+}
+
+// checkController rejects an issuer proof whose verification method belongs
+// to a different controller than the credential issuer, so that one trusted
+// issuer's key cannot vouch for another issuer's credentials.
+func checkController(verificationMethod, issuer string) error {
+	if verificationMethod == "" || strings.HasPrefix(verificationMethod, issuer+"#") {
+		return nil
+	}
+	return fmt.Errorf("verification method %s is not controlled by issuer %s", verificationMethod, issuer)
+}
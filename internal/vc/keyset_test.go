@@ -0,0 +1,120 @@
+package vc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bradtumy/agent-identity-poc/internal/did"
+)
+
+// didKeySigner returns a did:key identifier and a signer for its single
+// verification method.
+func didKeySigner(t *testing.T) (string, Signer) {
+	t.Helper()
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	id, err := did.NewKey(pub)
+	if err != nil {
+		t.Fatalf("did:key: %v", err)
+	}
+	return id, Signer{VerificationMethod: id + "#" + strings.TrimPrefix(id, did.KeyPrefix), Key: priv}
+}
+
+func TestDIDKeys(t *testing.T) {
+	keys := DIDKeys{Resolver: did.NewResolver(nil)}
+	issuer, issuerSigner := didKeySigner(t)
+	holder, holderSigner := didKeySigner(t)
+
+	// Neither the issuer key nor the holder key is known to the verifier
+	// beyond what their DIDs resolve to.
+	cred, err := IssueDelegation(issuer, holder, map[string]interface{}{"role": "data-fetcher"}, time.Hour, issuerSigner)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	raw, _ := json.Marshal(cred)
+	vp, err := CreatePresentation(holder, raw, "challenge", holderSigner)
+	if err != nil {
+		t.Fatalf("present: %v", err)
+	}
+	vpRaw, _ := json.Marshal(vp)
+	if _, challenge, err := ParsePresentation(vpRaw, keys); err != nil || challenge != "challenge" {
+		t.Fatalf("presentation rejected: %v", err)
+	}
+
+	// A presentation signed under another DID does not prove the subject.
+	other, otherSigner := didKeySigner(t)
+	vp, _ = CreatePresentation(holder, raw, "challenge", otherSigner)
+	vpRaw, _ = json.Marshal(vp)
+	if _, _, err := ParsePresentation(vpRaw, keys); err == nil {
+		t.Fatalf("presentation signed by %s accepted for %s", other, holder)
+	}
+
+	if _, err := keys.PublicKey(issuer+"#unknown", PurposeAssertion); err == nil {
+		t.Fatal("unknown verification method resolved")
+	}
+	if _, err := keys.PublicKey("http://keycloak#key-1", PurposeAssertion); err == nil {
+		t.Fatal("non-DID verification method resolved")
+	}
+}
+
+func TestDIDKeysRelationships(t *testing.T) {
+	const issuer = "did:example:issuer"
+	doc := &did.Document{ID: issuer}
+	signers := map[string]Signer{}
+	for _, name := range []string{"assert", "auth", "agree"} {
+		pub, priv, _ := ed25519.GenerateKey(nil)
+		mb, _ := did.EncodeMultikey(pub)
+		doc.VerificationMethod = append(doc.VerificationMethod, did.VerificationMethod{ID: "#" + name, Type: "Multikey", Controller: issuer, PublicKeyMultibase: mb})
+		signers[name] = Signer{VerificationMethod: issuer + "#" + name, Key: priv}
+	}
+	doc.AssertionMethod = []string{"#assert"}
+	doc.Authentication = []string{issuer + "#auth"}
+	doc.KeyAgreement = []string{"#agree"}
+	keys := DIDKeys{Resolver: did.ResolverFunc(func(context.Context, string) (*did.Document, error) { return doc, nil })}
+
+	for name, accepted := range map[string]bool{"assert": true, "auth": false, "agree": false} {
+		cred, _ := IssueDelegation(issuer, "did:example:agent", map[string]interface{}{"role": "data-fetcher"}, time.Hour, signers[name])
+		raw, _ := json.Marshal(cred)
+		if _, err := ParseCredential(raw, keys); (err == nil) != accepted {
+			t.Errorf("credential signed with #%s: err = %v, want accepted %v", name, err, accepted)
+		}
+	}
+	if _, err := keys.PublicKey(issuer+"#auth", PurposeAuthentication); err != nil {
+		t.Errorf("authentication key rejected for authentication: %v", err)
+	}
+	if _, err := keys.PublicKey(issuer+"#assert", PurposeAuthentication); err == nil {
+		t.Error("assertion-only key accepted for authentication")
+	}
+}
+
+func TestUntrustedIssuerNotResolved(t *testing.T) {
+	const issuer = "did:web:attacker.example"
+	resolved := 0
+	v := &Verifier{
+		Keys: DIDKeys{Resolver: did.ResolverFunc(func(context.Context, string) (*did.Document, error) {
+			resolved++
+			return nil, did.ErrNotFound
+		})},
+		Issuers: TrustedIssuers{"did:web:broker.example"},
+	}
+	_, priv, _ := ed25519.GenerateKey(nil)
+	signer := Signer{VerificationMethod: issuer + "#k", Key: priv}
+	for _, format := range []string{FormatLDP, FormatJWT, FormatSDJWT, FormatCOSE} {
+		cred := NewDelegation(issuer, "did:example:agent", map[string]interface{}{"role": "data-fetcher"}, time.Hour)
+		encoded, err := Encode(cred, format, signer)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", format, err)
+		}
+		raw, _ := json.Marshal(encoded)
+		if _, err := v.VerifyCredential(raw); !errors.Is(err, ErrUntrustedIssuer) {
+			t.Errorf("%s: err = %v, want untrusted issuer", format, err)
+		}
+	}
+	if resolved != 0 {
+		t.Fatalf("untrusted issuer resolved %d times", resolved)
+	}
+}
@@ -0,0 +1,104 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const legacyIDPrefix = "urn:sha256:"
+
+// LegacyDelegationToken is the credential shape /delegate issued before it
+// produced Credentials. It is only read, never issued.
+type LegacyDelegationToken struct {
+	Issuer            string                 `json:"issuer"`
+	CredentialSubject map[string]string      `json:"credentialSubject"`
+	Metadata          map[string]interface{} `json:"metadata"`
+	IssuanceDate      string                 `json:"issuanceDate"`
+	Proof             string                 `json:"proof"`
+}
+
+// isLegacyToken reports whether a JSON object has the legacy token shape:
+// a string proof and metadata outside credentialSubject.
+func isLegacyToken(raw json.RawMessage) bool {
+	var probe struct {
+		Proof    json.RawMessage `json:"proof"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if err := json.Unmarshal(raw, &probe); err != nil {
+		return false
+	}
+	return len(probe.Metadata) > 0 && len(probe.Proof) > 0 && probe.Proof[0] == '"'
+}
+
+// parseLegacyToken verifies the Ed25519 signature of a legacy token, which
+// covers its encoding/json serialization with an empty proof, and converts
+// it into a Credential. Its expiry stays governed by token_ttl.
+func parseLegacyToken(raw json.RawMessage, keys KeySet) (*Credential, error) {
+	var token LegacyDelegationToken
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return nil, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(token.Proof)
+	if err != nil {
+		return nil, fmt.Errorf("invalid legacy proof: %w", err)
+	}
+	unsigned := token
+	unsigned.Proof = ""
+	payload, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := keys.PublicKey("", PurposeAssertion)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(pub, payload, sig) {
+		return nil, ErrInvalidProof
+	}
+	sum := sha256.Sum256(payload)
+	return &Credential{
+		Context:      []string{credentialsV1Context},
+		ID:           legacyIDPrefix + hex.EncodeToString(sum[:]),
+		Type:         []string{"VerifiableCredential", "AgentDelegation"},
+		Issuer:       token.Issuer,
+		IssuanceDate: token.IssuanceDate,
+		CredentialSubject: CredentialSubject{
+			ID:       token.CredentialSubject["id"],
+			Metadata: token.Metadata,
+		},
+	}, nil
+}
+
+// IsLegacy reports whether cred was converted from a LegacyDelegationToken.
+func IsLegacy(cred *Credential) bool {
+	return cred.Proof == nil && strings.HasPrefix(cred.ID, legacyIDPrefix)
+}
+
+// MigrateLegacy returns an unsigned Credential carrying the subject and
+// metadata of a converted legacy token, valid from now until the token's
+// original expiry. token_ttl is dropped in favour of validUntil.
+func MigrateLegacy(legacy *Credential) (*Credential, error) {
+	exp, err := ttlExpiry(legacy)
+	if err != nil {
+		return nil, err
+	}
+	ttl := time.Until(exp)
+	if ttl <= 0 {
+		return nil, ErrExpired
+	}
+	metadata := make(map[string]interface{}, len(legacy.CredentialSubject.Metadata))
+	for k, v := range legacy.CredentialSubject.Metadata {
+		if k != "token_ttl" {
+			metadata[k] = v
+		}
+	}
+	cred := NewDelegation(legacy.Issuer, legacy.CredentialSubject.ID, metadata, ttl)
+	cred.ValidUntil = exp.UTC().Format(time.RFC3339)
+	return cred, nil
+}
@@ -0,0 +1,72 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// legacyToken signs a token the way /delegate used to.
+func legacyToken(t *testing.T, key ed25519.PrivateKey, issued time.Time, ttl int) json.RawMessage {
+	t.Helper()
+	token := LegacyDelegationToken{
+		Issuer:            "did:example:issuer",
+		CredentialSubject: map[string]string{"id": "did:example:123"},
+		Metadata:          map[string]interface{}{"role": "data-fetcher", "token_ttl": ttl},
+		IssuanceDate:      issued.UTC().Format(time.RFC3339),
+	}
+	payload, _ := json.Marshal(token)
+	token.Proof = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	raw, _ := json.Marshal(token)
+	return raw
+}
+
+func TestParseLegacyToken(t *testing.T) {
+	signer, pub := testSigner(t)
+	raw := legacyToken(t, signer.Key, time.Now(), 60)
+
+	cred, err := ParseCredential(raw, StaticKey(pub))
+	if err != nil {
+		t.Fatalf("parse legacy token: %v", err)
+	}
+	if !IsLegacy(cred) || cred.CredentialSubject.ID != "did:example:123" {
+		t.Fatalf("unexpected credential: %+v", cred)
+	}
+	if err := ValidateTTL(cred); err != nil {
+		t.Fatalf("fresh legacy token rejected: %v", err)
+	}
+
+	var tampered map[string]interface{}
+	json.Unmarshal(raw, &tampered)
+	tampered["metadata"].(map[string]interface{})["role"] = "admin"
+	forged, _ := json.Marshal(tampered)
+	if _, err := ParseCredential(forged, StaticKey(pub)); err == nil {
+		t.Fatal("tampered legacy token accepted")
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	signer, pub := testSigner(t)
+	issued := time.Now().Add(-30 * time.Second).Truncate(time.Second)
+	cred, err := ParseCredential(legacyToken(t, signer.Key, issued, 60), StaticKey(pub))
+	if err != nil {
+		t.Fatalf("parse legacy token: %v", err)
+	}
+	migrated, err := MigrateLegacy(cred)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if want := issued.Add(time.Minute).UTC().Format(time.RFC3339); migrated.ValidUntil != want {
+		t.Fatalf("validUntil = %s, want %s", migrated.ValidUntil, want)
+	}
+	if _, ok := migrated.CredentialSubject.Metadata["token_ttl"]; ok {
+		t.Fatal("token_ttl carried over")
+	}
+
+	expired, _ := ParseCredential(legacyToken(t, signer.Key, time.Now().Add(-time.Hour), 60), StaticKey(pub))
+	if _, err := MigrateLegacy(expired); err == nil {
+		t.Fatal("expired legacy token migrated")
+	}
+}
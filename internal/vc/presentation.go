@@ -0,0 +1,85 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const credentialsV1Context = "https://www.w3.org/2018/credentials/v1"
+
+// Presentation is a Verifiable Presentation signed by the credential holder.
+type Presentation struct {
+	Context              interface{}       `json:"@context"`
+	Type                 []string          `json:"type"`
+	Holder               string            `json:"holder"`
+	VerifiableCredential []json.RawMessage `json:"verifiableCredential"`
+	Proof                *Proof            `json:"proof,omitempty"`
+}
+
+// CreatePresentation wraps a credential (in any supported encoding) in a
+// presentation signed with the holder key over the broker-issued challenge.
+func CreatePresentation(holder string, credential json.RawMessage, challenge string, signer Signer) (*Presentation, error) {
+	vp := &Presentation{
+		Context:              []string{credentialsV1Context, DataIntegrityContext},
+		Type:                 []string{"VerifiablePresentation"},
+		Holder:               holder,
+		VerifiableCredential: []json.RawMessage{credential},
+	}
+	proof, err := createProof(vp, vp.Context, PurposeAuthentication, challenge, signer)
+	if err != nil {
+		return nil, err
+	}
+	vp.Proof = proof
+	return vp, nil
+}
+
+// ParsePresentation verifies a presentation carrying a single credential.
+// The credential is verified against the issuer key, and the presentation
+// proof against the holder key (see presentationKey). It
+// returns the credential and the challenge the holder signed; the caller
+// must check that the challenge was issued and has not been used.
+func ParsePresentation(raw json.RawMessage, keys KeySet) (*Credential, string, error) {
+	var vp Presentation
+	if err := json.Unmarshal(raw, &vp); err != nil {
+		return nil, "", fmt.Errorf("invalid presentation: %w", err)
+	}
+	if len(vp.VerifiableCredential) != 1 {
+		return nil, "", fmt.Errorf("presentation must contain exactly one credential")
+	}
+	cred, err := ParseCredential(vp.VerifiableCredential[0], keys)
+	if err != nil {
+		return nil, "", err
+	}
+	if vp.Holder != cred.CredentialSubject.ID {
+		return nil, "", fmt.Errorf("presentation holder is not the credential subject")
+	}
+	if vp.Proof == nil || vp.Proof.Challenge == "" {
+		return nil, "", fmt.Errorf("presentation proof has no challenge")
+	}
+	holderKey, err := presentationKey(cred, vp.Proof, keys)
+	if err != nil {
+		return nil, "", err
+	}
+	unsecured := vp
+	unsecured.Proof = nil
+	if err := checkProof(&unsecured, vp.Context, vp.Proof, PurposeAuthentication, holderKey); err != nil {
+		return nil, "", fmt.Errorf("invalid presentation proof: %w", err)
+	}
+	return cred, vp.Proof.Challenge, nil
+}
+
+// presentationKey returns the key bound into the credential's cnf claim. A
+// credential without one is held by its subject DID, and the presentation
+// must be signed with a verification method of that DID, resolved by keys.
+func presentationKey(cred *Credential, proof *Proof, keys KeySet) (ed25519.PublicKey, error) {
+	if cred.Cnf != nil && cred.Cnf.JWK != nil {
+		return cred.Cnf.JWK.PublicKey()
+	}
+	subject := cred.CredentialSubject.ID
+	if !strings.HasPrefix(subject, "did:") || !strings.HasPrefix(proof.VerificationMethod, subject+"#") {
+		return nil, fmt.Errorf("credential is not bound to a holder key")
+	}
+	return keys.PublicKey(proof.VerificationMethod, PurposeAuthentication)
+}
@@ -0,0 +1,50 @@
+package vc
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const jsonSchemaType = "JsonSchema"
+
+// SchemaRef is a credentialSchema entry referencing a JSON Schema.
+type SchemaRef struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// NewSchemaRef references the JSON Schema with the given ID.
+func NewSchemaRef(id string) SchemaRef {
+	return SchemaRef{ID: id, Type: jsonSchemaType}
+}
+
+// SchemaValidator validates a JSON document against the schema with the
+// given ID.
+type SchemaValidator interface {
+	Validate(schemaID string, doc interface{}) error
+}
+
+// ValidateSchemas validates cred against every schema in credentialSchema.
+// Credentials without a credentialSchema pass.
+func ValidateSchemas(cred *Credential, validator SchemaValidator) error {
+	if len(cred.CredentialSchema) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	for _, ref := range cred.CredentialSchema {
+		if ref.Type != jsonSchemaType {
+			return fmt.Errorf("unsupported credentialSchema type %q", ref.Type)
+		}
+		if err := validator.Validate(ref.ID, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package vc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SDJWTType is the typ header of SD-JWT credentials.
+const SDJWTType = "vc+sd-jwt"
+
+const (
+	sdClaim    = "_sd"
+	sdAlgClaim = "_sd_alg"
+	sdAlg      = "sha-256"
+)
+
+// alwaysDisclosed lists metadata claims that stay in the signed payload
+// because every verifier needs them.
+var alwaysDisclosed = map[string]bool{"token_ttl": true}
+
+type sdJWTClaims struct {
+	JWTClaims
+	SDAlg string `json:"_sd_alg"`
+}
+
+// EncodeSDJWT issues the credential as an SD-JWT in which every metadata
+// claim except token_ttl is selectively disclosable. The returned string
+// carries all disclosures; holders strip the ones they do not want to
+// reveal with SelectDisclosures.
+func EncodeSDJWT(cred *Credential, signer Signer) (string, error) {
+	body := *cred
+	body.Proof = nil
+	meta := map[string]interface{}{}
+	var digests []string
+	var disclosures []string
+	names := make([]string, 0, len(cred.CredentialSubject.Metadata))
+	for name := range cred.CredentialSubject.Metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := cred.CredentialSubject.Metadata[name]
+		if alwaysDisclosed[name] {
+			meta[name] = value
+			continue
+		}
+		disclosure, err := newDisclosure(name, value)
+		if err != nil {
+			return "", err
+		}
+		disclosures = append(disclosures, disclosure)
+		digests = append(digests, disclosureDigest(disclosure))
+	}
+	sort.Strings(digests)
+	meta[sdClaim] = digests
+	body.CredentialSubject.Metadata = meta
+
+	claims, err := jwtClaims(&body)
+	if err != nil {
+		return "", err
+	}
+	header := jwtHeader{Alg: algEdDSA, Typ: SDJWTType, Kid: signer.VerificationMethod}
+	jws, err := signJWS(header, sdJWTClaims{JWTClaims: claims, SDAlg: sdAlg}, signer.Key)
+	if err != nil {
+		return "", err
+	}
+	// Each disclosure is followed by a "~", so that with none the result is
+	// "<jws>~".
+	return strings.Join(append([]string{jws}, disclosures...), "~") + "~", nil
+}
+
+// SelectDisclosures returns a copy of the SD-JWT that only carries the
+// disclosures for the named metadata claims.
+func SelectDisclosures(sdjwt string, names ...string) (string, error) {
+	parts := strings.Split(sdjwt, "~")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("malformed sd-jwt")
+	}
+	keep := map[string]bool{}
+	for _, n := range names {
+		keep[n] = true
+	}
+	out := []string{parts[0]}
+	for _, d := range parts[1:] {
+		if d == "" {
+			continue
+		}
+		name, _, err := parseDisclosure(d)
+		if err != nil {
+			return "", err
+		}
+		if keep[name] {
+			out = append(out, d)
+		}
+	}
+	return strings.Join(out, "~") + "~", nil
+}
+
+// DecodeSDJWT verifies an SD-JWT and returns the credential with only the
+// disclosed metadata claims filled in.
+func DecodeSDJWT(sdjwt string, keys KeySet) (*Credential, error) {
+	parts := strings.Split(sdjwt, "~")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("malformed sd-jwt")
+	}
+	if parts[len(parts)-1] != "" {
+		return nil, fmt.Errorf("key binding JWTs are not supported")
+	}
+	var claims sdJWTClaims
+	header, err := verifyJWS(parts[0], keys, &claims)
+	if err != nil {
+		return nil, err
+	}
+	if header.Typ != SDJWTType {
+		return nil, fmt.Errorf("unexpected typ %q", header.Typ)
+	}
+	if claims.SDAlg != sdAlg {
+		return nil, fmt.Errorf("unsupported _sd_alg %q", claims.SDAlg)
+	}
+	cred, err := credentialFromClaims(&claims.JWTClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := cred.CredentialSubject.Metadata
+	if meta == nil {
+		return nil, fmt.Errorf("missing credential metadata")
+	}
+	digests := map[string]bool{}
+	if list, ok := meta[sdClaim].([]interface{}); ok {
+		for _, d := range list {
+			if s, ok := d.(string); ok {
+				digests[s] = true
+			}
+		}
+	}
+	delete(meta, sdClaim)
+
+	seen := map[string]bool{}
+	for _, d := range parts[1 : len(parts)-1] {
+		digest := disclosureDigest(d)
+		if !digests[digest] {
+			return nil, fmt.Errorf("disclosure not covered by the issuer signature")
+		}
+		if seen[digest] {
+			return nil, fmt.Errorf("duplicate disclosure")
+		}
+		seen[digest] = true
+		name, value, err := parseDisclosure(d)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := meta[name]; exists || name == sdClaim {
+			return nil, fmt.Errorf("disclosure overwrites claim %q", name)
+		}
+		meta[name] = value
+	}
+	return cred, nil
+}
+
+func newDisclosure(name string, value interface{}) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal([]interface{}{base64.RawURLEncoding.EncodeToString(salt), name, value})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func parseDisclosure(d string) (string, interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(d)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed disclosure: %w", err)
+	}
+	var arr []interface{}
+	if err := json.Unmarshal(b, &arr); err != nil || len(arr) != 3 {
+		return "", nil, fmt.Errorf("malformed disclosure")
+	}
+	name, ok := arr[1].(string)
+	if !ok {
+		return "", nil, fmt.Errorf("malformed disclosure claim name")
+	}
+	return name, arr[2], nil
+}
+
+func disclosureDigest(d string) string {
+	sum := sha256.Sum256([]byte(d))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,72 @@
+package vc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSDJWTSelectiveDisclosure(t *testing.T) {
+	signer, pub := testSigner(t)
+	cred := NewDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{
+		"role":      "data-fetcher",
+		"owner":     "alice@example.com",
+		"token_ttl": 3600,
+	}, 0)
+	full, err := EncodeSDJWT(cred, signer)
+	if err != nil {
+		t.Fatalf("encode sd-jwt: %v", err)
+	}
+	if strings.Contains(strings.Split(full, "~")[0], "alice@example.com") {
+		t.Fatalf("owner leaked into signed payload")
+	}
+
+	roleOnly, err := SelectDisclosures(full, "role")
+	if err != nil {
+		t.Fatalf("select disclosures: %v", err)
+	}
+	got, err := DecodeSDJWT(roleOnly, StaticKey(pub))
+	if err != nil {
+		t.Fatalf("valid sd-jwt rejected: %v", err)
+	}
+	meta := got.CredentialSubject.Metadata
+	if meta["role"] != "data-fetcher" || meta["token_ttl"] == nil {
+		t.Fatalf("missing disclosed claims: %v", meta)
+	}
+	if _, ok := meta["owner"]; ok {
+		t.Fatalf("undisclosed owner present: %v", meta)
+	}
+
+	both, _ := SelectDisclosures(full, "role", "owner")
+	got, err = DecodeSDJWT(both, StaticKey(pub))
+	if err != nil {
+		t.Fatalf("valid sd-jwt rejected: %v", err)
+	}
+	if got.CredentialSubject.Metadata["owner"] != "alice@example.com" {
+		t.Fatalf("owner not disclosed: %v", got.CredentialSubject.Metadata)
+	}
+
+	forged, _ := newDisclosure("role", "notifier")
+	tampered := strings.Split(full, "~")[0] + "~" + forged + "~"
+	if _, err := DecodeSDJWT(tampered, StaticKey(pub)); err == nil {
+		t.Fatalf("forged disclosure accepted")
+	}
+}
+
+func TestSDJWTWithoutDisclosures(t *testing.T) {
+	signer, pub := testSigner(t)
+	cred := NewDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{"token_ttl": 3600}, 0)
+	sdjwt, err := EncodeSDJWT(cred, signer)
+	if err != nil {
+		t.Fatalf("encode sd-jwt: %v", err)
+	}
+	if strings.Count(sdjwt, "~") != 1 || !strings.HasSuffix(sdjwt, "~") {
+		t.Fatalf("unexpected serialization %q", sdjwt)
+	}
+	got, err := DecodeSDJWT(sdjwt, StaticKey(pub))
+	if err != nil {
+		t.Fatalf("sd-jwt without disclosures rejected: %v", err)
+	}
+	if got.ID != cred.ID || got.CredentialSubject.Metadata["token_ttl"] == nil {
+		t.Fatalf("unexpected credential %+v", got)
+	}
+}
@@ -0,0 +1,126 @@
+package vc
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Status check results.
+var (
+	ErrRevoked   = NewError(CodeRevoked, "credential revoked")
+	ErrSuspended = NewError(CodeSuspended, "credential suspended")
+)
+
+const (
+	credentialsV2Context = "https://www.w3.org/ns/credentials/v2"
+	statusEntryType      = "BitstringStatusListEntry"
+	statusListType       = "BitstringStatusList"
+)
+
+// StatusEntry is a BitstringStatusListEntry in credentialStatus.
+type StatusEntry struct {
+	ID                   string `json:"id"`
+	Type                 string `json:"type"`
+	StatusPurpose        string `json:"statusPurpose"`
+	StatusListIndex      string `json:"statusListIndex"`
+	StatusListCredential string `json:"statusListCredential"`
+}
+
+// NewStatusEntry points at position index of the list published at listURL.
+func NewStatusEntry(listURL, purpose string, index int) StatusEntry {
+	idx := strconv.Itoa(index)
+	return StatusEntry{
+		ID:                   listURL + "#" + idx,
+		Type:                 statusEntryType,
+		StatusPurpose:        purpose,
+		StatusListIndex:      idx,
+		StatusListCredential: listURL,
+	}
+}
+
+// StatusListCredential is a signed BitstringStatusListCredential.
+type StatusListCredential struct {
+	Context           interface{}       `json:"@context"`
+	ID                string            `json:"id"`
+	Type              []string          `json:"type"`
+	Issuer            string            `json:"issuer"`
+	ValidFrom         string            `json:"validFrom"`
+	CredentialSubject StatusListSubject `json:"credentialSubject"`
+	Proof             *Proof            `json:"proof,omitempty"`
+}
+
+// StatusListSubject carries the compressed bitstring.
+type StatusListSubject struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"`
+	StatusPurpose string `json:"statusPurpose"`
+	EncodedList   string `json:"encodedList"`
+}
+
+// IssueStatusList signs the encoded bitstring for purpose as the status list
+// credential published at listURL.
+func IssueStatusList(issuer, listURL, purpose, encodedList string, signer Signer) (*StatusListCredential, error) {
+	slc := &StatusListCredential{
+		Context:   []string{credentialsV2Context},
+		ID:        listURL,
+		Type:      []string{"VerifiableCredential", "BitstringStatusListCredential"},
+		Issuer:    issuer,
+		ValidFrom: time.Now().UTC().Format(time.RFC3339),
+		CredentialSubject: StatusListSubject{
+			ID:            listURL + "#list",
+			Type:          statusListType,
+			StatusPurpose: purpose,
+			EncodedList:   encodedList,
+		},
+	}
+	proof, err := createProof(slc, slc.Context, PurposeAssertion, "", signer)
+	if err != nil {
+		return nil, err
+	}
+	slc.Proof = proof
+	return slc, nil
+}
+
+// VerifyStatusList checks the proof on a status list credential.
+func VerifyStatusList(slc *StatusListCredential, pub ed25519.PublicKey) error {
+	unsecured := *slc
+	unsecured.Proof = nil
+	return checkProof(&unsecured, slc.Context, slc.Proof, PurposeAssertion, pub)
+}
+
+// StatusLookup reports the status bit of an entry in a status list.
+type StatusLookup interface {
+	Status(listURL, purpose string, index int) (bool, error)
+}
+
+// CheckStatus consults every credentialStatus entry and returns ErrRevoked
+// or ErrSuspended when the corresponding bit is set.
+func CheckStatus(cred *Credential, lookup StatusLookup) error {
+	for _, entry := range cred.CredentialStatus {
+		if entry.Type != statusEntryType {
+			return fmt.Errorf("unsupported credentialStatus type %q", entry.Type)
+		}
+		idx, err := strconv.Atoi(entry.StatusListIndex)
+		if err != nil {
+			return fmt.Errorf("invalid statusListIndex: %w", err)
+		}
+		set, err := lookup.Status(entry.StatusListCredential, entry.StatusPurpose, idx)
+		if err != nil {
+			return err
+		}
+		if !set {
+			continue
+		}
+		switch entry.StatusPurpose {
+		case "revocation":
+			return ErrRevoked
+		case "suspension":
+			return ErrSuspended
+		default:
+			return fmt.Errorf("credential status %q is set", entry.StatusPurpose)
+		}
+	}
+	return nil
+}
@@ -5,15 +5,92 @@ import (
 	"time"
 )
 
-// ValidateTTL ensures the credential has not expired based on issuanceDate and token_ttl.
+// Validity check results.
+var (
+	ErrExpired     = NewError(CodeExpired, "credential has expired")
+	ErrNotYetValid = NewError(CodeNotYetValid, "credential is not yet valid")
+)
+
+// Clock returns the current time. It is injectable so validity checks can be
+// tested deterministically.
+type Clock func() time.Time
+
+// ValidityChecker checks a credential's validity period.
+type ValidityChecker struct {
+	// Now defaults to time.Now.
+	Now Clock
+	// Skew is the clock drift tolerated on both ends of the period.
+	Skew time.Duration
+}
+
+// Check returns ErrNotYetValid before validFrom (or issuanceDate when
+// validFrom is absent) and ErrExpired after validUntil. Credentials issued
+// before validUntil existed are still accepted and expire after their
+// token_ttl metadata entry.
+func (v ValidityChecker) Check(cred *Credential) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	from, err := validFrom(cred)
+	if err != nil {
+		return err
+	}
+	if now.Add(v.Skew).Before(from) {
+		return ErrNotYetValid
+	}
+	until, err := validUntil(cred)
+	if err != nil {
+		return err
+	}
+	if now.Add(-v.Skew).After(until) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// ValidateTTL ensures the credential is within its validity period using the
+// system clock and no skew tolerance.
 func ValidateTTL(cred *Credential) error {
+	return ValidityChecker{}.Check(cred)
+}
+
+func validFrom(cred *Credential) (time.Time, error) {
+	if cred.ValidFrom != "" {
+		t, err := time.Parse(time.RFC3339, cred.ValidFrom)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid validFrom: %w", err)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, cred.IssuanceDate)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid issuanceDate: %w", err)
+	}
+	return t, nil
+}
+
+func validUntil(cred *Credential) (time.Time, error) {
+	if cred.ValidUntil != "" {
+		t, err := time.Parse(time.RFC3339, cred.ValidUntil)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid validUntil: %w", err)
+		}
+		return t, nil
+	}
+	return ttlExpiry(cred)
+}
+
+// ttlExpiry computes the expiry of legacy credentials from issuanceDate and
+// the token_ttl metadata entry.
+func ttlExpiry(cred *Credential) (time.Time, error) {
 	issued, err := time.Parse(time.RFC3339, cred.IssuanceDate)
 	if err != nil {
-		return fmt.Errorf("invalid issuanceDate: %w", err)
+		return time.Time{}, fmt.Errorf("invalid issuanceDate: %w", err)
 	}
 	ttlVal, ok := cred.CredentialSubject.Metadata["token_ttl"]
 	if !ok {
-		return fmt.Errorf("missing token_ttl")
+		return time.Time{}, fmt.Errorf("missing validUntil or token_ttl")
 	}
 	var ttlSeconds float64
 	switch v := ttlVal.(type) {
@@ -24,11 +101,13 @@ func ValidateTTL(cred *Credential) error {
 	case int64:
 		ttlSeconds = float64(v)
 	default:
-		return fmt.Errorf("invalid token_ttl type")
-	}
-	expiry := issued.Add(time.Duration(ttlSeconds) * time.Second)
-	if time.Now().UTC().After(expiry) {
-		return fmt.Errorf("expired_token")
+		return time.Time{}, fmt.Errorf("invalid token_ttl type")
 	}
-	return nil
+	return issued.Add(time.Duration(ttlSeconds) * time.Second), nil
+}
+
+// Expiry returns the end of a credential's validity period: validUntil, or
+// issuanceDate + token_ttl for legacy credentials.
+func Expiry(cred *Credential) (time.Time, error) {
+	return validUntil(cred)
 }
@@ -1,42 +1,68 @@
 package vc
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
+	"crypto/ed25519"
+	"time"
 )
 
-// VerifySignature validates the `proof` field using shared secret for now
-func VerifySignature(cred *Credential, sharedSecret []byte) error {
-	copyCred := *cred
-	proof := copyCred.Proof
-	copyCred.Proof = ""
-	payload, err := json.Marshal(copyCred)
-	if err != nil {
-		return err
-	}
-	mac := hmac.New(sha256.New, sharedSecret)
-	mac.Write(payload)
-	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
-	if !hmac.Equal([]byte(expected), []byte(proof)) {
-		return fmt.Errorf("invalid credential signature")
+// VerifySignature validates the Data Integrity `proof` using the issuer's public key
+func VerifySignature(cred *Credential, pub ed25519.PublicKey) error {
+	return Verify(cred, pub)
+}
+
+// TrustedIssuer is an issuer accepted by the verifier, with the credential
+// types and roles it may issue. An empty list allows any value.
+type TrustedIssuer struct {
+	ID              string
+	CredentialTypes []string
+	Roles           []string
+	// MaxLifetime caps the lifetime of credentials renewed for a role.
+	MaxLifetime map[string]time.Duration
+}
+
+// IssuerRegistry looks up trusted issuers by ID.
+type IssuerRegistry interface {
+	TrustedIssuer(id string) (TrustedIssuer, bool)
+}
+
+// TrustedIssuers is a fixed IssuerRegistry trusting each listed issuer for
+// any credential type and role.
+type TrustedIssuers []string
+
+// TrustedIssuer implements IssuerRegistry.
+func (t TrustedIssuers) TrustedIssuer(id string) (TrustedIssuer, bool) {
+	for _, issuer := range t {
+		if issuer == id {
+			return TrustedIssuer{ID: id}, true
+		}
 	}
-	return nil
+	return TrustedIssuer{}, false
 }
 
-// CheckTrustedIssuer ensures the issuer matches known/trusted sources
-func CheckTrustedIssuer(cred *Credential, trustedIssuers []string) error {
-	for _, issuer := range trustedIssuers {
-		if cred.Issuer == issuer {
-			return nil
+// CheckTrustedIssuer ensures the issuer is in the registry and may issue the
+// credential's types and role.
+func CheckTrustedIssuer(cred *Credential, registry IssuerRegistry) error {
+	issuer, ok := registry.TrustedIssuer(cred.Issuer)
+	if !ok {
+		return ErrUntrustedIssuer
+	}
+	if len(issuer.CredentialTypes) > 0 {
+		for _, t := range cred.Type {
+			if t != "VerifiableCredential" && !contains(issuer.CredentialTypes, t) {
+				return NewError(CodeIssuerUntrusted, "issuer %s may not issue %s credentials", cred.Issuer, t)
+			}
 		}
 	}
-	return fmt.Errorf("untrusted issuer")
+	if len(issuer.Roles) > 0 {
+		role, _ := cred.CredentialSubject.Metadata["role"].(string)
+		if !contains(issuer.Roles, role) {
+			return NewError(CodeIssuerUntrusted, "issuer %s may not grant role %q", cred.Issuer, role)
+		}
+	}
+	return nil
 }
 
-// CheckTTL ensures the credential has not expired
+// CheckTTL ensures the credential is within its validity period
 func CheckTTL(cred *Credential) error {
 	return ValidateTTL(cred)
 }
@@ -1,39 +1,56 @@
 package vc
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
 	"testing"
 	"time"
 )
 
+func testSigner(t *testing.T) (Signer, ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return Signer{VerificationMethod: "http://keycloak:8080/realms/agent-identity-poc#broker-key-1", Key: priv}, pub
+}
+
 func TestVerifySignature(t *testing.T) {
-	secret := []byte("mysecret")
-	cred, err := IssueDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{"token_ttl": 3600}, secret)
+	signer, pub := testSigner(t)
+	cred, err := IssueDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{"token_ttl": 3600}, 0, signer)
 	if err != nil {
 		t.Fatalf("issue credential: %v", err)
 	}
-	if err := VerifySignature(cred, secret); err != nil {
+	if err := VerifySignature(cred, pub); err != nil {
 		t.Fatalf("valid signature rejected: %v", err)
 	}
-	if err := VerifySignature(cred, []byte("wrong")); err == nil {
+	_, otherPub := testSigner(t)
+	if err := VerifySignature(cred, otherPub); err == nil {
 		t.Fatalf("invalid signature accepted")
 	}
+	cred.CredentialSubject.Metadata["role"] = "notifier"
+	if err := VerifySignature(cred, pub); err == nil {
+		t.Fatalf("tampered credential accepted")
+	}
 }
 
 func TestCheckTrustedIssuer(t *testing.T) {
-	secret := []byte("mysecret")
+	signer, _ := testSigner(t)
 	issuer := "http://keycloak:8080/realms/agent-identity-poc"
-	cred, _ := IssueDelegation(issuer, "did:example:123", map[string]interface{}{"token_ttl": 3600}, secret)
-	if err := CheckTrustedIssuer(cred, []string{issuer}); err != nil {
+	cred, _ := IssueDelegation(issuer, "did:example:123", map[string]interface{}{"token_ttl": 3600}, 0, signer)
+	if err := CheckTrustedIssuer(cred, TrustedIssuers{issuer}); err != nil {
 		t.Fatalf("trusted issuer rejected: %v", err)
 	}
-	if err := CheckTrustedIssuer(cred, []string{"http://malicious"}); err == nil {
+	if err := CheckTrustedIssuer(cred, TrustedIssuers{"http://malicious"}); err == nil {
 		t.Fatalf("untrusted issuer accepted")
 	}
 }
 
 func TestValidateTTL(t *testing.T) {
-	secret := []byte("mysecret")
-	cred, _ := IssueDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{"token_ttl": 3600}, secret)
+	signer, _ := testSigner(t)
+	cred, _ := IssueDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{"token_ttl": 3600}, 0, signer)
 	if err := ValidateTTL(cred); err != nil {
 		t.Fatalf("valid ttl rejected: %v", err)
 	}
@@ -43,3 +60,73 @@ func TestValidateTTL(t *testing.T) {
 		t.Fatalf("expired ttl accepted")
 	}
 }
+
+func TestVerifyAfterReserialization(t *testing.T) {
+	signer, pub := testSigner(t)
+	cred, err := IssueDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{"role": "data-fetcher", "token_ttl": 3600, "note": "a<b & c"}, 0, signer)
+	if err != nil {
+		t.Fatalf("issue credential: %v", err)
+	}
+	original, _ := json.Marshal(cred)
+
+	// A generic map round-trip reorders keys and changes indentation.
+	var generic map[string]interface{}
+	if err := json.Unmarshal(original, &generic); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	reordered, _ := json.MarshalIndent(generic, "", "    ")
+
+	variants := map[string][]byte{
+		"original":   original,
+		"reordered":  reordered,
+		"float ttl":  bytes.Replace(original, []byte(`"token_ttl":3600`), []byte(`"token_ttl":3600.0`), 1),
+		"exp ttl":    bytes.Replace(reordered, []byte(`"token_ttl": 3600`), []byte(`"token_ttl": 3.6e3`), 1),
+		"raw html":   bytes.Replace(original, []byte(`a\u003cb \u0026 c`), []byte(`a<b & c`), 1),
+		"escaped id": bytes.Replace(original, []byte(`did:example:123`), []byte(`did\u003aexample:123`), 1),
+	}
+	for name, raw := range variants {
+		if bytes.Equal(raw, original) && name != "original" {
+			t.Fatalf("%s: variant not applied", name)
+		}
+		if _, err := ParseCredential(raw, StaticKey(pub)); err != nil {
+			t.Errorf("%s: re-serialized credential rejected: %v", name, err)
+		}
+	}
+
+	tampered := bytes.Replace(original, []byte(`"token_ttl":3600`), []byte(`"token_ttl":3601`), 1)
+	if _, err := ParseCredential(tampered, StaticKey(pub)); err == nil {
+		t.Fatalf("tampered credential accepted")
+	}
+}
+
+func TestValidityChecker(t *testing.T) {
+	signer, _ := testSigner(t)
+	cred, _ := IssueDelegation("http://keycloak:8080/realms/agent-identity-poc", "did:example:123", map[string]interface{}{}, time.Hour, signer)
+	from, _ := time.Parse(time.RFC3339, cred.ValidFrom)
+	until, _ := time.Parse(time.RFC3339, cred.ValidUntil)
+	at := func(ts time.Time) Clock { return func() time.Time { return ts } }
+
+	tests := []struct {
+		name string
+		now  time.Time
+		skew time.Duration
+		want error
+	}{
+		{"within period", from.Add(time.Minute), 0, nil},
+		{"before validFrom", from.Add(-time.Minute), 0, ErrNotYetValid},
+		{"before validFrom within skew", from.Add(-time.Minute), 2 * time.Minute, nil},
+		{"after validUntil", until.Add(time.Minute), 0, ErrExpired},
+		{"after validUntil within skew", until.Add(time.Minute), 2 * time.Minute, nil},
+	}
+	for _, tc := range tests {
+		err := ValidityChecker{Now: at(tc.now), Skew: tc.skew}.Check(cred)
+		if err != tc.want {
+			t.Errorf("%s: got %v want %v", tc.name, err, tc.want)
+		}
+	}
+
+	cred.ValidUntil = ""
+	if err := ValidateTTL(cred); err == nil {
+		t.Errorf("credential without validUntil or token_ttl accepted")
+	}
+}
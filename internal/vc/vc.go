@@ -1,23 +1,30 @@
 package vc
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/json"
-	"fmt"
+	"crypto/ed25519"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Credential is a basic Verifiable Credential structure.
 
 type Credential struct {
 	Context           interface{}       `json:"@context"`
+	ID                string            `json:"id,omitempty"`
 	Type              []string          `json:"type"`
 	Issuer            string            `json:"issuer"`
 	IssuanceDate      string            `json:"issuanceDate"`
+	ValidFrom         string            `json:"validFrom,omitempty"`
+	ValidUntil        string            `json:"validUntil,omitempty"`
 	CredentialSubject CredentialSubject `json:"credentialSubject"`
-	Proof             string            `json:"proof"`
+	CredentialStatus  []StatusEntry     `json:"credentialStatus,omitempty"`
+	CredentialSchema  []SchemaRef       `json:"credentialSchema,omitempty"`
+	// Cnf binds the credential to a key held by the subject.
+	Cnf *Confirmation `json:"cnf,omitempty"`
+	// ParentCredential embeds the credential this one was delegated from.
+	ParentCredential *Credential `json:"parentCredential,omitempty"`
+	Proof            *Proof      `json:"proof,omitempty"`
 }
 
 type CredentialSubject struct {
@@ -30,44 +37,39 @@ type Task struct {
 	Params map[string]interface{} `json:"params"`
 }
 
-// IssueDelegation creates and signs a simple credential asserting delegation.
-func IssueDelegation(issuer, subjectDID string, metadata map[string]interface{}, secret []byte) (*Credential, error) {
+// NewDelegation builds an unsigned credential asserting delegation that is
+// valid from now for ttl. A zero ttl leaves validUntil unset, in which case
+// expiry falls back to a token_ttl metadata entry.
+func NewDelegation(issuer, subjectDID string, metadata map[string]interface{}, ttl time.Duration) *Credential {
+	now := time.Now().UTC()
 	cred := &Credential{
-		Context:      "https://www.w3.org/2018/credentials/v1",
+		Context:      []string{credentialsV1Context, DataIntegrityContext},
+		ID:           "urn:uuid:" + uuid.NewString(),
 		Type:         []string{"VerifiableCredential", "AgentDelegation"},
 		Issuer:       issuer,
-		IssuanceDate: time.Now().UTC().Format(time.RFC3339),
+		IssuanceDate: now.Format(time.RFC3339),
 		CredentialSubject: CredentialSubject{
 			ID:       subjectDID,
 			Metadata: metadata,
 		},
 	}
+	if ttl > 0 {
+		cred.ValidFrom = now.Format(time.RFC3339)
+		cred.ValidUntil = now.Add(ttl).Format(time.RFC3339)
+	}
+	return cred
+}
 
-	payload, err := json.Marshal(cred)
-	if err != nil {
+// IssueDelegation creates and signs a simple credential asserting delegation.
+func IssueDelegation(issuer, subjectDID string, metadata map[string]interface{}, ttl time.Duration, signer Signer) (*Credential, error) {
+	cred := NewDelegation(issuer, subjectDID, metadata, ttl)
+	if err := Sign(cred, signer); err != nil {
 		return nil, err
 	}
-	mac := hmac.New(sha256.New, secret)
-	mac.Write(payload)
-	cred.Proof = base64.StdEncoding.EncodeToString(mac.Sum(nil))
-
 	return cred, nil
 }
 
-// Verify checks the credential proof using the signing secret.
-func Verify(cred *Credential, secret []byte) error {
-	copyCred := *cred
-	proof := copyCred.Proof
-	copyCred.Proof = ""
-	payload, err := json.Marshal(copyCred)
-	if err != nil {
-		return err
-	}
-	mac := hmac.New(sha256.New, secret)
-	mac.Write(payload)
-	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
-	if !hmac.Equal([]byte(expected), []byte(proof)) {
-		return fmt.Errorf("invalid credential proof")
-	}
-	return nil
+// Verify checks the credential proof against the issuer's public key.
+func Verify(cred *Credential, pub ed25519.PublicKey) error {
+	return verifyProof(cred, pub)
 }